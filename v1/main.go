@@ -37,7 +37,7 @@ func main() {
 			iters := 0
 			for i := 1; i < maxIters; i++ {
 				z = cmplx.Pow(z, 2) + c
-				if real(z)+imag(z) > 4 {
+				if real(z)*real(z)+imag(z)*imag(z) > 4 {
 					iters = i
 					break
 				}
@@ -46,7 +46,7 @@ func compute(bx int, by int, out chan blockResult) {
 			curIters := maxIters
 			for i := 1; i < maxIters; i++ {
 				z = cmplx.Pow(z, 2) + c
-				if real(z)+imag(z) > 4 {
+				if real(z)*real(z)+imag(z)*imag(z) > 4 {
 					curIters = i
 					break
 				}
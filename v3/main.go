@@ -2,13 +2,20 @@ package main
 
 import (
 	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/png"
 	"log"
+	"math"
 	"math/cmplx"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 )
 
 type blockResult struct {
@@ -24,6 +31,11 @@ const (
 	points    int        = 2000
 	maxIters  int        = 256
 	blockSize int        = 32
+	maxPoints int        = 4096
+	maxLimit  int        = 65536
+	// maxWork bounds the pixels times the iterations of a view, to what
+	// the default view costs.
+	maxWork int = points * points * maxIters
 )
 
 var (
@@ -31,58 +43,182 @@ var (
 	Build   string
 )
 
-func compute(bx int, by int, out chan blockResult) {
-	xStep := (real(pEnd) - real(pStart)) / float64(points)
-	yStep := (imag(pEnd) - imag(pStart)) / float64(points)
+// explorerPage is the interactive explorer, a single page rendering its
+// views with /render.
+//
+//go:embed explorer.html
+var explorerPage []byte
+
+// view is the part of the plane rendered, its size in pixels and the
+// iterations. Julia views iterate every point with the constant c.
+type view struct {
+	start    complex128
+	end      complex128
+	width    int
+	height   int
+	maxIters int
+	julia    bool
+	c        complex128
+	inverted bool
+}
+
+func defaultView() view {
+	return view{start: pStart, end: pEnd, width: points, height: points, maxIters: maxIters}
+}
+
+func compute(ctx context.Context, v view, bx int, by int, out chan blockResult) {
+	xStep := (real(v.end) - real(v.start)) / float64(v.width)
+	yStep := (imag(v.end) - imag(v.start)) / float64(v.height)
 
 	var ret blockResult
 
 	ret.blockX = bx
 	ret.blockY = by
-	for x := 0; x < blockSize; x++ {
-		for y := 0; y < blockSize; y++ {
-			cReal := real(pStart) + float64(x+blockSize*bx)*xStep
-			cImag := imag(pStart) + float64(y+blockSize*by)*yStep
+	for x := 0; x < blockSize && x+blockSize*bx < v.width; x++ {
+		if ctx.Err() != nil {
+			return
+		}
+		for y := 0; y < blockSize && y+blockSize*by < v.height; y++ {
+			cReal := real(v.start) + float64(x+blockSize*bx)*xStep
+			cImag := imag(v.start) + float64(y+blockSize*by)*yStep
 			c := complex(cReal, cImag)
 			z := complex(0, 0)
-			curIters := maxIters
-			for i := 1; i < maxIters; i++ {
+			if v.julia {
+				z, c = c, v.c
+			}
+			curIters := v.maxIters
+			for i := 1; i < v.maxIters; i++ {
 				z = cmplx.Pow(z, 2) + c
-				if real(z)+imag(z) > 4 {
+				if real(z)*real(z)+imag(z)*imag(z) > 4 {
 					curIters = i
 					break
 				}
 			}
-			ret.Rectangle[x][y] = uint8(curIters)
+			shade := curIters * 256 / v.maxIters
+			if shade > 255 {
+				shade = 255
+			}
+			ret.Rectangle[x][y] = uint8(shade)
 		}
 	}
 
-	out <- ret
+	select {
+	case out <- ret:
+	case <-ctx.Done():
+	}
 }
 
-func calculateMandel() *image.Gray {
-	img := image.NewGray(image.Rect(0, 0, points, points))
+// calculateMandel renders the view. It stops once ctx is done, and then
+// returns its error.
+func calculateMandel(ctx context.Context, v view) (*image.Gray, error) {
+	img := image.NewGray(image.Rect(0, 0, v.width, v.height))
 	results := make(chan blockResult)
 	var res blockResult
 
-	for i := 0; i < int(points/blockSize); i++ {
-		for j := 0; j < int(points/blockSize); j++ {
-			go compute(i, j, results)
+	cols := (v.width + blockSize - 1) / blockSize
+	rows := (v.height + blockSize - 1) / blockSize
+	for i := 0; i < cols; i++ {
+		for j := 0; j < rows; j++ {
+			go compute(ctx, v, i, j, results)
 		}
 	}
 
-	for i := 0; i < int(points/blockSize); i++ {
-		for j := 0; j < int(points/blockSize); j++ {
-			res = <-results
+	for i := 0; i < cols; i++ {
+		for j := 0; j < rows; j++ {
+			select {
+			case res = <-results:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
 			for x, ycol := range res.Rectangle {
 				for y, r := range ycol {
+					if v.inverted {
+						r = 255 - r
+					}
 					img.Set(x+blockSize*res.blockX, y+blockSize*res.blockY, color.Gray{r})
 				}
 			}
 		}
 	}
 
-	return img
+	return img, nil
+}
+
+// parseView reads the view of /render from the query: the center cx,cy
+// and the horizontal span of the plane, the width and height in pixels,
+// maxIters, the palette, gray or inverted, and the constant c=real,imag
+// of Julia views. Missing values are those of the default view.
+func parseView(q url.Values) (view, error) {
+	v := defaultView()
+	var err error
+	num := func(name string, def float64) float64 {
+		s := q.Get(name)
+		if s == "" || err != nil {
+			return def
+		}
+		f, perr := strconv.ParseFloat(s, 64)
+		if perr != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			err = fmt.Errorf("invalid %s: %s", name, s)
+		}
+		return f
+	}
+	integer := func(name string, def int) int {
+		s := q.Get(name)
+		if s == "" || err != nil {
+			return def
+		}
+		n, perr := strconv.Atoi(s)
+		if perr != nil || n < 1 || n > maxLimit {
+			err = fmt.Errorf("invalid %s: %s", name, s)
+		}
+		return n
+	}
+
+	center := (pStart + pEnd) / 2
+	cx := num("cx", real(center))
+	cy := num("cy", imag(center))
+	span := num("span", real(pEnd)-real(pStart))
+	v.width = integer("width", v.width)
+	v.height = integer("height", v.height)
+	v.maxIters = integer("maxIters", v.maxIters)
+	if err != nil {
+		return v, err
+	}
+	if !(span > 0) {
+		return v, errors.New("span must be positive")
+	}
+	if v.width > maxPoints || v.height > maxPoints {
+		return v, fmt.Errorf("image larger than %dx%d", maxPoints, maxPoints)
+	}
+	if v.width*v.height*v.maxIters > maxWork {
+		return v, fmt.Errorf("width x height x maxIters larger than %d", maxWork)
+	}
+
+	// The vertical span follows the aspect of the image.
+	half := complex(span/2, span/2*float64(v.height)/float64(v.width))
+	v.start, v.end = complex(cx, cy)-half, complex(cx, cy)+half
+
+	if s := q.Get("c"); s != "" {
+		parts := strings.Split(s, ",")
+		if len(parts) != 2 {
+			return v, fmt.Errorf("invalid c: %s", s)
+		}
+		re, rerr := strconv.ParseFloat(parts[0], 64)
+		im, ierr := strconv.ParseFloat(parts[1], 64)
+		if rerr != nil || ierr != nil || cmplx.IsNaN(complex(re, im)) || cmplx.IsInf(complex(re, im)) {
+			return v, fmt.Errorf("invalid c: %s", s)
+		}
+		v.julia, v.c = true, complex(re, im)
+	}
+
+	switch q.Get("palette") {
+	case "", "gray":
+	case "inverted":
+		v.inverted = true
+	default:
+		return v, fmt.Errorf("unknown palette: %s", q.Get("palette"))
+	}
+	return v, nil
 }
 
 func sendImage(w http.ResponseWriter, img *image.Gray) {
@@ -98,14 +234,50 @@ func sendImage(w http.ResponseWriter, img *image.Gray) {
 	}
 }
 
+// wantsExplorer reports whether a request for / comes from a browser, which
+// gets the explorer instead of the default image.
+func wantsExplorer(r *http.Request) bool {
+	return r.URL.Path == "/" && r.URL.RawQuery == "" && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
 func handler(w http.ResponseWriter, r *http.Request) {
-	img := calculateMandel()
+	if wantsExplorer(r) {
+		explorerHandler(w, r)
+		return
+	}
+	img, err := calculateMandel(r.Context(), defaultView())
+	if err != nil {
+		log.Printf("Render canceled: error=%s", err)
+		return
+	}
+	sendImage(w, img)
+}
+
+func renderHandler(w http.ResponseWriter, r *http.Request) {
+	v, err := parseView(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	img, err := calculateMandel(r.Context(), v)
+	if err != nil {
+		log.Printf("Render canceled: error=%s", err)
+		return
+	}
 	sendImage(w, img)
 }
 
+func explorerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(explorerPage)))
+	w.Write(explorerPage)
+}
+
 func main() {
 	log.Printf("Staring mandelbrot: version=%s build=%s\n", Version, Build)
 
 	http.HandleFunc("/", handler)
+	http.HandleFunc("/render", renderHandler)
+	http.HandleFunc("/explore", explorerHandler)
 	http.ListenAndServe(":8080", nil)
 }
@@ -34,7 +34,7 @@ func (s *server) ComputeMandel(ctx context.Context, in *pb.BlockRequest) (*pb.Bl
 			curIters := in.MaxIters
 			for i := int32(1); i < in.MaxIters; i++ {
 				z = cmplx.Pow(z, 2) + c
-				if real(z)+imag(z) > 4 {
+				if real(z)*real(z)+imag(z)*imag(z) > 4 {
 					curIters = i
 					break
 				}
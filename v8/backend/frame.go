@@ -0,0 +1,125 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/hasiotis/mandelbrot/v8/mandel"
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxFrameBlocks bounds the blocks of a frame computed when a request
+// lists none.
+const maxFrameBlocks = 1 << 16
+
+// frameBlocks returns the blocks of a frame request, every block of the
+// frame when none are listed.
+func frameBlocks(in *pb.FrameRequest) ([]*pb.BlockIndex, error) {
+	if in.Frame == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "frame parameters missing")
+	}
+	w, h := in.Frame.Size()
+	width, height, blockSize := int(w), int(h), int(in.Frame.BlockSize)
+	if width <= 0 || height <= 0 || width > mandel.MaxSize || height > mandel.MaxSize {
+		return nil, status.Errorf(codes.InvalidArgument, "width and height out of range [1, %d]: %dx%d", mandel.MaxSize, width, height)
+	}
+	if blockSize <= 0 || blockSize > mandel.MaxBlockSize {
+		return nil, status.Errorf(codes.InvalidArgument, "blockSize out of range [1, %d]: %d", mandel.MaxBlockSize, blockSize)
+	}
+
+	// Partial blocks on the right and bottom edges count as blocks.
+	cols := (width + blockSize - 1) / blockSize
+	rows := (height + blockSize - 1) / blockSize
+	if len(in.Blocks) == 0 {
+		if cols*rows > maxFrameBlocks {
+			return nil, status.Errorf(codes.InvalidArgument, "frame of %d blocks, at most %d can be computed at once", cols*rows, maxFrameBlocks)
+		}
+		blocks := make([]*pb.BlockIndex, 0, cols*rows)
+		for j := 0; j < rows; j++ {
+			for i := 0; i < cols; i++ {
+				blocks = append(blocks, &pb.BlockIndex{XBlock: int32(i), YBlock: int32(j)})
+			}
+		}
+		return blocks, nil
+	}
+
+	for _, bi := range in.Blocks {
+		if bi.XBlock < 0 || int(bi.XBlock) >= cols || bi.YBlock < 0 || int(bi.YBlock) >= rows {
+			return nil, status.Errorf(codes.InvalidArgument, "block out of range: x=%d y=%d", bi.XBlock, bi.YBlock)
+		}
+	}
+	return in.Blocks, nil
+}
+
+// ComputeFrame renders the blocks of a frame on all cores and streams each
+// block back as soon as it is done, so replies arrive out of order.
+func (s *server) ComputeFrame(in *pb.FrameRequest, stream pb.MandelService_ComputeFrameServer) error {
+	blocks, err := frameBlocks(in)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	todo := make(chan *pb.BlockIndex)
+	go func() {
+		defer close(todo)
+		for _, bi := range blocks {
+			select {
+			case todo <- bi:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		sendMux  sync.Mutex
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for bi := range todo {
+				req := *in.Frame
+				req.XBlock = bi.XBlock
+				req.YBlock = bi.YBlock
+				br, err := s.ComputeMandel(ctx, &req)
+				if err != nil {
+					fail(err)
+					return
+				}
+				br.XBlock = bi.XBlock
+				br.YBlock = bi.YBlock
+
+				sendMux.Lock()
+				err = stream.Send(br)
+				sendMux.Unlock()
+				if err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
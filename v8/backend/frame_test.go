@@ -0,0 +1,142 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/hasiotis/mandelbrot/v8/mandel"
+	"github.com/hasiotis/mandelbrot/v8/packed"
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// frameStream collects the replies of ComputeFrame.
+type frameStream struct {
+	grpc.ServerStream
+	mux     sync.Mutex
+	replies []*pb.BlockReply
+}
+
+func (s *frameStream) Context() context.Context { return context.Background() }
+
+func (s *frameStream) Send(br *pb.BlockReply) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.replies = append(s.replies, br)
+	return nil
+}
+
+// The blocks streamed by ComputeFrame, the narrower and lower ones on the
+// edges included, assemble into the image of their viewport.
+func TestComputeFrame(t *testing.T) {
+	const width, height, blockSize = 100, 70, mandel.DefaultBlockSize
+	frame := &pb.BlockRequest{
+		PStart:    &pb.ComplexPoint{X: -2, Y: -1.2},
+		PEnd:      &pb.ComplexPoint{X: 0.6, Y: 1.2},
+		Width:     width,
+		Height:    height,
+		MaxIters:  300,
+		BlockSize: blockSize,
+		Smooth:    true,
+	}
+	vp := mandel.Viewport{Start: -2 - 1.2i, End: 0.6 + 1.2i, Width: width, Height: height}
+	want, err := mandel.Render(context.Background(), vp, mandel.Params{MaxIters: 300, Smooth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, encoding := range []pb.Encoding{pb.Encoding_REPEATED, pb.Encoding_PACKED} {
+		req := *frame
+		req.Encoding = encoding
+		req.Compression = pb.Compression_ZSTD
+		stream := &frameStream{}
+		if err := (&server{}).ComputeFrame(&pb.FrameRequest{Frame: &req}, stream); err != nil {
+			t.Fatalf("ComputeFrame %s: %s", encoding, err)
+		}
+
+		cols, rows := (width+blockSize-1)/blockSize, (height+blockSize-1)/blockSize
+		if len(stream.replies) != cols*rows {
+			t.Fatalf("ComputeFrame %s: %d blocks, want %d", encoding, len(stream.replies), cols*rows)
+		}
+		iters := make([]int32, width*height)
+		smooth := make([]float32, width*height)
+		seen := make(map[[2]int32]bool)
+		for _, br := range stream.replies {
+			x0, y0 := int(br.XBlock)*blockSize, int(br.YBlock)*blockSize
+			w, h := blockSize, blockSize
+			if width-x0 < w {
+				w = width - x0
+			}
+			if height-y0 < h {
+				h = height - y0
+			}
+			results, err := packed.Unpack(br)
+			if err != nil {
+				t.Fatalf("block %d,%d: %s", br.XBlock, br.YBlock, err)
+			}
+			if len(results) != w*h || len(br.Smooth) != w*h {
+				t.Fatalf("block %d,%d: %d counts, %d smooth counts, want %dx%d", br.XBlock, br.YBlock, len(results), len(br.Smooth), w, h)
+			}
+			seen[[2]int32{br.XBlock, br.YBlock}] = true
+			for x := 0; x < w; x++ {
+				for y := 0; y < h; y++ {
+					iters[(y0+y)*width+x0+x] = results[x*h+y]
+					smooth[(y0+y)*width+x0+x] = br.Smooth[x*h+y]
+				}
+			}
+		}
+		if len(seen) != cols*rows {
+			t.Errorf("ComputeFrame %s: %d distinct blocks, want %d", encoding, len(seen), cols*rows)
+		}
+		for n := range iters {
+			if iters[n] != want.Iters[n] || smooth[n] != want.Smooth[n] {
+				t.Fatalf("ComputeFrame %s: pixel %d,%d = %d %g, want %d %g", encoding, n%width, n/width, iters[n], smooth[n], want.Iters[n], want.Smooth[n])
+			}
+		}
+	}
+}
+
+// Only the blocks listed are computed, and blocks outside the frame are
+// rejected.
+func TestComputeFrameBlocks(t *testing.T) {
+	frame := &pb.BlockRequest{
+		PStart:    &pb.ComplexPoint{X: -2, Y: -1.2},
+		PEnd:      &pb.ComplexPoint{X: 0.6, Y: 1.2},
+		Width:     100,
+		Height:    70,
+		MaxIters:  100,
+		BlockSize: 32,
+	}
+	stream := &frameStream{}
+	blocks := []*pb.BlockIndex{{XBlock: 3, YBlock: 2}, {XBlock: 0, YBlock: 1}}
+	if err := (&server{}).ComputeFrame(&pb.FrameRequest{Frame: frame, Blocks: blocks}, stream); err != nil {
+		t.Fatal(err)
+	}
+	if len(stream.replies) != len(blocks) {
+		t.Fatalf("%d blocks, want %d", len(stream.replies), len(blocks))
+	}
+	for _, br := range stream.replies {
+		req := *frame
+		req.XBlock, req.YBlock = br.XBlock, br.YBlock
+		single, err := (&server{}).ComputeMandel(context.Background(), &req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(br.Results) != len(single.Results) {
+			t.Fatalf("block %d,%d: %d counts, ComputeMandel %d", br.XBlock, br.YBlock, len(br.Results), len(single.Results))
+		}
+		for n := range br.Results {
+			if br.Results[n] != single.Results[n] {
+				t.Fatalf("block %d,%d differs from ComputeMandel at %d", br.XBlock, br.YBlock, n)
+			}
+		}
+	}
+
+	for _, bi := range []*pb.BlockIndex{{XBlock: 4, YBlock: 0}, {XBlock: 0, YBlock: 3}, {XBlock: -1, YBlock: 0}} {
+		err := (&server{}).ComputeFrame(&pb.FrameRequest{Frame: frame, Blocks: []*pb.BlockIndex{bi}}, &frameStream{})
+		if err == nil {
+			t.Errorf("ComputeFrame of block %d,%d outside the frame succeeded", bi.XBlock, bi.YBlock)
+		}
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"log"
 	"net"
 
-	"math/cmplx"
-
+	"github.com/hasiotis/mandelbrot/v8/compute"
+	"github.com/hasiotis/mandelbrot/v8/packed"
 	pb "github.com/hasiotis/mandelbrot/v8/rpc"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -20,30 +22,20 @@ var (
 
 type server struct{}
 
+// ComputeMandel renders a block, packing the results when the request
+// asks for the packed encoding. The render stops when the call is canceled.
 func (s *server) ComputeMandel(ctx context.Context, in *pb.BlockRequest) (*pb.BlockReply, error) {
-	br := new(pb.BlockReply)
-
-	xStep := (in.PEnd.X - in.PStart.X) / float64(in.Points)
-	yStep := (in.PEnd.Y - in.PStart.Y) / float64(in.Points)
-
-	for x := int32(0); x < in.BlockSize; x++ {
-		for y := int32(0); y < in.BlockSize; y++ {
-			cReal := in.PStart.X + float64(x+in.BlockSize*in.XBlock)*xStep
-			cImag := in.PStart.Y + float64(y+in.BlockSize*in.YBlock)*yStep
-			c := complex(cReal, cImag)
-			z := complex(0, 0)
-			curIters := in.MaxIters
-			for i := int32(1); i < in.MaxIters; i++ {
-				z = cmplx.Pow(z, 2) + c
-				if real(z)+imag(z) > 4 {
-					curIters = i
-					break
-				}
-			}
-			br.Results = append(br.Results, curIters)
-		}
+	br, err := compute.Block(ctx, in)
+	if err != nil || in.Encoding != pb.Encoding_PACKED {
+		return br, err
 	}
 
+	br.BitDepth = packed.BitDepth(in.MaxIters)
+	br.Compression = in.Compression
+	if br.Packed, err = packed.Pack(br.Results, br.BitDepth, in.Compression); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	br.Results = nil
 	return br, nil
 }
 
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Invalid requests reach the frontend over gRPC as InvalidArgument
+// statuses, which it reports to the browser instead of retrying them on
+// another backend.
+func TestComputeMandelInvalidArgument(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterMandelServiceServer(s, &server{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := pb.NewMandelServiceClient(conn)
+
+	in := &pb.BlockRequest{
+		PStart:    &pb.ComplexPoint{X: -2, Y: -1.5},
+		PEnd:      &pb.ComplexPoint{X: 1, Y: 1.5},
+		Points:    64,
+		MaxIters:  100,
+		BlockSize: 32,
+		Encoding:  pb.Encoding_PACKED,
+	}
+	if _, err := client.ComputeMandel(context.Background(), in); err != nil {
+		t.Fatalf("ComputeMandel of a valid request: %s", err)
+	}
+
+	in.Formula = "nosuchformula"
+	_, err = client.ComputeMandel(context.Background(), in)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ComputeMandel of an unknown formula = %v, want an InvalidArgument status", err)
+	}
+
+	stream, err := client.ComputeFrame(context.Background(), &pb.FrameRequest{Frame: in})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ComputeFrame of an unknown formula = %v, want an InvalidArgument status", err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hasiotis/mandelbrot/v8/mandel"
+	"golang.org/x/net/context"
+)
+
+var (
+	Version string
+	Build   string
+	Date    string
+)
+
+// paramFlags collects repeated -param name=value flags.
+type paramFlags map[string]float64
+
+func (pf paramFlags) String() string {
+	return fmt.Sprint(map[string]float64(pf))
+}
+
+func (pf paramFlags) Set(v string) error {
+	kv := strings.SplitN(v, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("expected name=value: %q", v)
+	}
+	f, err := strconv.ParseFloat(kv[1], 64)
+	if err != nil {
+		return fmt.Errorf("invalid value of %s: %q", kv[0], kv[1])
+	}
+	pf[kv[0]] = f
+	return nil
+}
+
+var algorithms = map[string]mandel.Algorithm{
+	"auto":         mandel.Auto,
+	"float64":      mandel.Float64,
+	"bigfloat":     mandel.BigFloat,
+	"perturbation": mandel.Perturbation,
+}
+
+func main() {
+	var (
+		out       = flag.String("o", "mandelbrot.png", "output file")
+		cx        = flag.String("cx", "-0.7", "center of the region, real part")
+		cy        = flag.String("cy", "0", "center of the region, imaginary part")
+		span      = flag.String("span", "3", "width of the region")
+		width     = flag.Int("width", 1024, "width of the image in pixels")
+		height    = flag.Int("height", 0, "height of the image in pixels, the width when 0")
+		maxIters  = flag.Int("maxIters", 256, "maximum number of iterations per point")
+		formula   = flag.String("formula", "mandelbrot", "formula, one of "+strings.Join(mandel.Formulas(), ", "))
+		julia     = flag.String("julia", "", "render the Julia set of the constant re,im")
+		smooth    = flag.Bool("smooth", false, "shade with fractional iteration counts")
+		radius    = flag.Float64("escapeRadius", mandel.DefaultEscapeRadius, "escape radius, larger radii shade smoother")
+		deep      = flag.Bool("deep", false, "render with arbitrary precision")
+		algorithm = flag.String("algorithm", "auto", "algorithm of deep renders: auto, float64, bigfloat or perturbation")
+		params    = paramFlags{}
+	)
+	flag.Var(params, "param", "formula parameter name=value, may be repeated")
+	flag.Parse()
+
+	log.Printf("Starting mandelbrot: version=%s build=%s date=%s\n", Version, Build, Date)
+
+	p := mandel.Params{
+		MaxIters:      *maxIters,
+		Formula:       *formula,
+		FormulaParams: params,
+		Smooth:        *smooth,
+		EscapeRadius:  *radius,
+	}
+	a, ok := algorithms[strings.ToLower(*algorithm)]
+	if !ok {
+		log.Fatalf("Unknown algorithm: %s", *algorithm)
+	}
+	p.Algorithm = a
+	if *julia != "" {
+		var re, im float64
+		if _, err := fmt.Sscanf(*julia, "%g,%g", &re, &im); err != nil {
+			log.Fatalf("Invalid julia constant: %s", *julia)
+		}
+		p.Julia, p.C = true, complex(re, im)
+	}
+
+	if *height == 0 {
+		*height = *width
+	}
+	vp := mandel.Viewport{Width: *width, Height: *height}
+	if *deep {
+		vp.Deep = &mandel.DeepViewport{CenterX: *cx, CenterY: *cy, Span: *span}
+	} else {
+		var fx, fy, fs float64
+		for _, f := range []struct {
+			name string
+			v    string
+			dst  *float64
+		}{{"cx", *cx, &fx}, {"cy", *cy, &fy}, {"span", *span, &fs}} {
+			v, err := strconv.ParseFloat(f.v, 64)
+			if err != nil {
+				log.Fatalf("Invalid %s: %s", f.name, f.v)
+			}
+			*f.dst = v
+		}
+		half := complex(fs/2, fs/2*float64(*height)/float64(*width))
+		vp.Start, vp.End = complex(fx, fy)-half, complex(fx, fy)+half
+	}
+
+	img, err := mandel.Render(context.Background(), vp, p)
+	if err != nil {
+		log.Fatalf("Render failed: %s", err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := png.Encode(f, shade(img, *maxIters)); err != nil {
+		f.Close()
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Rendered image: file=%s width=%d height=%d maxIters=%d", *out, *width, *height, *maxIters)
+}
+
+// shade maps iteration counts onto grays, points inside the set black.
+func shade(img *mandel.Image, maxIters int) image.Image {
+	gray := image.NewGray(image.Rect(0, 0, img.Width, img.Height))
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			n := y*img.Width + x
+			if int(img.Iters[n]) >= maxIters {
+				continue
+			}
+			v := float64(img.Iters[n])
+			if img.Smooth != nil {
+				v = float64(img.Smooth[n])
+			}
+			gray.SetGray(x, y, color.Gray{uint8(255 * v / float64(maxIters))})
+		}
+	}
+	return gray
+}
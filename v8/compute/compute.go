@@ -0,0 +1,70 @@
+// Package compute renders the blocks of gRPC requests with the mandel
+// kernel. It keeps the generated rpc package free of the kernel, and is
+// shared by the backend and by the local fallback of the frontend.
+package compute
+
+import (
+	"github.com/hasiotis/mandelbrot/v8/mandel"
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// algorithms maps the algorithms of the wire onto the ones of the kernel.
+var algorithms = map[pb.Algorithm]mandel.Algorithm{
+	pb.Algorithm_AUTO:         mandel.Auto,
+	pb.Algorithm_FLOAT64:      mandel.Float64,
+	pb.Algorithm_BIGFLOAT:     mandel.BigFloat,
+	pb.Algorithm_PERTURBATION: mandel.Perturbation,
+}
+
+// Viewport returns the region of the complex plane of a request.
+func Viewport(in *pb.BlockRequest) mandel.Viewport {
+	width, height := in.Size()
+	vp := mandel.Viewport{
+		Start:  complex(in.GetPStart().GetX(), in.GetPStart().GetY()),
+		End:    complex(in.GetPEnd().GetX(), in.GetPEnd().GetY()),
+		Width:  int(width),
+		Height: int(height),
+	}
+	if d := in.GetDeep(); d != nil {
+		vp.Deep = &mandel.DeepViewport{CenterX: d.CenterX, CenterY: d.CenterY, Span: d.Span}
+	}
+	return vp
+}
+
+// Params returns the fractal iterated by a request.
+func Params(in *pb.BlockRequest) mandel.Params {
+	return mandel.Params{
+		MaxIters:      int(in.GetMaxIters()),
+		Formula:       in.GetFormula(),
+		FormulaParams: in.GetFormulaParams(),
+		Julia:         in.GetKind() == pb.FractalKind_JULIA,
+		C:             complex(in.GetC().GetX(), in.GetC().GetY()),
+		Smooth:        in.GetSmooth(),
+		Algorithm:     algorithms[in.GetAlgorithm()],
+		EscapeRadius:  in.GetEscapeRadius(),
+	}
+}
+
+// Block renders the block of a request with the mandel kernel. The results
+// are returned unpacked and marked with the version of the kernel, invalid
+// requests are rejected with an InvalidArgument status. Renders stop with
+// a Canceled or DeadlineExceeded status once ctx is done.
+func Block(ctx context.Context, in *pb.BlockRequest) (*pb.BlockReply, error) {
+	if in.Kind == pb.FractalKind_JULIA && in.C == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "julia set requires the constant c")
+	}
+	b, err := mandel.RenderBlock(ctx, Viewport(in), Params(in), int(in.BlockSize), int(in.XBlock), int(in.YBlock))
+	switch {
+	case err == nil:
+	case err == context.Canceled:
+		return nil, status.Errorf(codes.Canceled, "%v", err)
+	case err == context.DeadlineExceeded:
+		return nil, status.Errorf(codes.DeadlineExceeded, "%v", err)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return &pb.BlockReply{Results: b.Iters, Smooth: b.Smooth, KernelVersion: mandel.KernelVersion}, nil
+}
@@ -0,0 +1,70 @@
+package compute
+
+import (
+	"testing"
+
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testRequest() *pb.BlockRequest {
+	return &pb.BlockRequest{
+		PStart:    &pb.ComplexPoint{X: -2, Y: -1.5},
+		PEnd:      &pb.ComplexPoint{X: 1, Y: 1.5},
+		Points:    64,
+		MaxIters:  100,
+		BlockSize: 32,
+	}
+}
+
+func TestBlock(t *testing.T) {
+	in := testRequest()
+	in.XBlock, in.YBlock = 1, 1
+	br, err := Block(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(br.Results) != 32*32 || br.Smooth != nil {
+		t.Errorf("reply of %d counts and %d smooth counts, want 32x32 counts", len(br.Results), len(br.Smooth))
+	}
+	if br.KernelVersion == 0 {
+		t.Errorf("reply without a kernel version")
+	}
+}
+
+// Errors of the kernel come back with the status code of their cause.
+func TestBlockErrors(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		modify func(in *pb.BlockRequest)
+		code   codes.Code
+	}{
+		{"unknown formula", context.Background(), func(in *pb.BlockRequest) { in.Formula = "nosuchformula" }, codes.InvalidArgument},
+		{"unknown parameter", context.Background(), func(in *pb.BlockRequest) {
+			in.Formula = "phoenix"
+			in.FormulaParams = map[string]float64{"q": 1}
+		}, codes.InvalidArgument},
+		{"julia without c", context.Background(), func(in *pb.BlockRequest) { in.Kind = pb.FractalKind_JULIA }, codes.InvalidArgument},
+		{"block outside", context.Background(), func(in *pb.BlockRequest) { in.XBlock = 2 }, codes.InvalidArgument},
+		{"canceled", canceled, func(in *pb.BlockRequest) {}, codes.Canceled},
+		{"deadline", expired, func(in *pb.BlockRequest) {}, codes.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := testRequest()
+			tt.modify(in)
+			_, err := Block(tt.ctx, in)
+			if status.Code(err) != tt.code {
+				t.Errorf("Block = %v, want a %s status", err, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"log"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// healthTimeout bounds a Health.Check of a backend.
+const healthTimeout = 2 * time.Second
+
+// backend is a connection to a backend server. Its address and connection
+// never change, redialing replaces the backend in the pool. online,
+// outstanding, the number of RPCs in flight, and retired are guarded by
+// the mutex of the pool.
+type backend struct {
+	addr        string
+	conn        *grpc.ClientConn
+	client      pb.MandelServiceClient
+	health      pb.HealthClient
+	online      bool
+	outstanding int
+	retired     bool
+}
+
+// backendPool holds the backends and balances requests across the
+// online ones.
+type backendPool struct {
+	mux         sync.Mutex
+	cond        *sync.Cond
+	backends    map[string]*backend
+	lastRefresh time.Time
+}
+
+var backends = newBackendPool()
+
+func newBackendPool() *backendPool {
+	bp := &backendPool{backends: make(map[string]*backend)}
+	bp.cond = sync.NewCond(&bp.mux)
+	return bp
+}
+
+// update dials the backends that are new in addrs and retires the ones
+// that are gone. retry redials the backends that are kept, replacing them
+// with new ones.
+func (bp *backendPool) update(addrs []string, retry bool) {
+	bp.mux.Lock()
+	defer bp.mux.Unlock()
+
+	keep := make(map[string]bool)
+	for _, addr := range addrs {
+		keep[addr] = true
+		old, ok := bp.backends[addr]
+		if ok && !retry {
+			continue
+		}
+		conn, err := grpc.Dial(addr, grpc.WithInsecure())
+		if err != nil {
+			log.Printf("Backend server is not reachable: addr=%s error=%s\n", addr, err)
+			continue
+		}
+		be := &backend{
+			addr:   addr,
+			conn:   conn,
+			client: pb.NewMandelServiceClient(conn),
+			health: pb.NewHealthClient(conn),
+		}
+		if ok {
+			be.online = old.online
+			bp.retireLocked(old)
+		}
+		bp.backends[addr] = be
+	}
+
+	for addr, be := range bp.backends {
+		if !keep[addr] {
+			log.Printf("Backend server removed: addr=%s", addr)
+			delete(bp.backends, addr)
+			bp.retireLocked(be)
+		}
+	}
+	bp.cond.Broadcast()
+}
+
+// retireLocked takes a backend out of the pool. Its connection is closed
+// once the RPCs still in flight on it are done.
+func (bp *backendPool) retireLocked(be *backend) {
+	be.retired = true
+	be.online = false
+	if be.outstanding == 0 {
+		be.conn.Close()
+	}
+}
+
+// check runs a Health.Check against every backend at once.
+func (bp *backendPool) check() {
+	bp.mux.Lock()
+	health := make(map[*backend]pb.HealthClient, len(bp.backends))
+	for _, be := range bp.backends {
+		health[be] = be.health
+	}
+	bp.mux.Unlock()
+
+	var wg sync.WaitGroup
+	for be, hc := range health {
+		wg.Add(1)
+		go func(be *backend, hc pb.HealthClient) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+			defer cancel()
+			r, err := hc.Check(ctx, &pb.HealthCheckRequest{Service: "Check"})
+			online := err == nil && r.GetStatus() == pb.HealthCheckResponse_SERVING
+
+			bp.mux.Lock()
+			defer bp.mux.Unlock()
+			if be.retired {
+				return
+			}
+			if online && !be.online {
+				log.Printf("Backend server is online: addr=%s", be.addr)
+			}
+			if !online && be.online {
+				log.Printf("Backend server is not reachable: addr=%s status=%s error=%v\n", be.addr, r.GetStatus(), err)
+			}
+			be.online = online
+			bp.cond.Broadcast()
+		}(be, hc)
+	}
+	wg.Wait()
+}
+
+// refreshed returns the time the backends were last resolved and checked,
+// zero before the first time.
+func (bp *backendPool) refreshed() time.Time {
+	bp.mux.Lock()
+	defer bp.mux.Unlock()
+	return bp.lastRefresh
+}
+
+// online returns the number of online backends and of all backends.
+func (bp *backendPool) online() (int, int) {
+	bp.mux.Lock()
+	defer bp.mux.Unlock()
+	n := 0
+	for _, be := range bp.backends {
+		if be.online {
+			n++
+		}
+	}
+	return n, len(bp.backends)
+}
+
+// acquire picks the online backend with the least outstanding requests,
+// waiting while every online backend has maxInflight requests in flight.
+// It returns nil when no backend is online, or once ctx is done.
+func (bp *backendPool) acquire(ctx context.Context, maxInflight int) *backend {
+	if maxInflight < 1 {
+		maxInflight = 1
+	}
+	var stop chan struct{}
+	defer func() {
+		if stop != nil {
+			close(stop)
+		}
+	}()
+
+	bp.mux.Lock()
+	defer bp.mux.Unlock()
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		var best *backend
+		anyOnline := false
+		for _, be := range bp.backends {
+			if !be.online {
+				continue
+			}
+			anyOnline = true
+			if be.outstanding < maxInflight && (best == nil || be.outstanding < best.outstanding) {
+				best = be
+			}
+		}
+		if best != nil {
+			best.outstanding++
+			return best
+		}
+		if !anyOnline {
+			return nil
+		}
+		if stop == nil {
+			stop = make(chan struct{})
+			go bp.wakeOnDone(ctx, stop)
+		}
+		bp.cond.Wait()
+	}
+}
+
+// wakeOnDone wakes the callers of acquire once ctx is done, unless stop is
+// closed first.
+func (bp *backendPool) wakeOnDone(ctx context.Context, stop chan struct{}) {
+	select {
+	case <-ctx.Done():
+		bp.mux.Lock()
+		bp.cond.Broadcast()
+		bp.mux.Unlock()
+	case <-stop:
+	}
+}
+
+// release returns a backend picked by acquire, closing it when it was
+// retired and this was its last RPC.
+func (bp *backendPool) release(be *backend) {
+	bp.mux.Lock()
+	be.outstanding--
+	if be.retired && be.outstanding == 0 {
+		be.conn.Close()
+	}
+	bp.cond.Broadcast()
+	bp.mux.Unlock()
+}
+
+// markOffline takes a backend out of rotation after a failed call, until a
+// health check finds it serving again.
+func (bp *backendPool) markOffline(be *backend, err error) {
+	bp.mux.Lock()
+	defer bp.mux.Unlock()
+	if be.online {
+		log.Printf("Backend server is not reachable: addr=%s error=%s\n", be.addr, err)
+		be.online = false
+	}
+}
+
+// backendOnline reports whether any backend is online.
+func backendOnline() bool {
+	n, _ := backends.online()
+	return n > 0
+}
+
+// backendConnect resolves the configured backends, connects to new ones
+// and checks the health of all of them, redialing those that are kept
+// when retry is set. It runs in the background, never on the path of a
+// request, and does nothing in standalone mode.
+func backendConnect(retry bool) {
+	if C.Standalone {
+		return
+	}
+	backends.mux.Lock()
+	backends.lastRefresh = time.Now()
+	backends.mux.Unlock()
+
+	refreshBackends(retry)
+}
+
+// refreshBackends updates the pool to the configured backends and checks
+// their health. redial reconnects to the backends that are kept.
+func refreshBackends(redial bool) {
+	backends.update(backendAddrs(), redial)
+	backends.check()
+}
+
+// backendAddrs returns the addresses of the backends from every configured
+// source: the Backends list, the A records of BackendDNS (host:port), the
+// SRV records of BackendSRV and the Backends of BackendFile. BackendServer
+// is only used when none of them is configured.
+func backendAddrs() []string {
+	if len(C.Backends) == 0 && C.BackendDNS == "" && C.BackendSRV == "" && C.BackendFile == "" {
+		return []string{C.BackendServer}
+	}
+
+	addrs := append([]string{}, C.Backends...)
+	if C.BackendDNS != "" {
+		host, port, err := net.SplitHostPort(C.BackendDNS)
+		if err != nil {
+			log.Printf("Invalid backend DNS name: BackendDNS=%s error=%s", C.BackendDNS, err)
+		} else if ips, err := net.LookupHost(host); err != nil {
+			log.Printf("Backend DNS lookup failed: host=%s error=%s", host, err)
+		} else {
+			for _, ip := range ips {
+				addrs = append(addrs, net.JoinHostPort(ip, port))
+			}
+		}
+	}
+	if C.BackendSRV != "" {
+		_, srvs, err := net.LookupSRV("", "", C.BackendSRV)
+		if err != nil {
+			log.Printf("Backend SRV lookup failed: name=%s error=%s", C.BackendSRV, err)
+		}
+		for _, srv := range srvs {
+			addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+		}
+	}
+	addrs = append(addrs, fileBackends()...)
+
+	seen := make(map[string]bool)
+	unique := addrs[:0]
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			unique = append(unique, addr)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+var (
+	backendFileMux     sync.Mutex
+	backendFile        string
+	backendFileAddrs   []string
+	backendFileWatcher *fsnotify.Watcher
+)
+
+// watchBackendFile reads the Backends list of path, and reads it again
+// whenever the file changes. The watcher of the previous path is closed.
+func watchBackendFile(path string) {
+	backendFileMux.Lock()
+	changed := path != backendFile
+	var old *fsnotify.Watcher
+	if changed {
+		backendFile = path
+		backendFileAddrs = nil
+		old, backendFileWatcher = backendFileWatcher, nil
+	}
+	backendFileMux.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	if !changed || path == "" {
+		return
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	read := func() {
+		if err := v.ReadInConfig(); err != nil {
+			log.Printf("Unable to read backend file: file=%s error=%s", path, err)
+			return
+		}
+		backendFileMux.Lock()
+		if backendFile == path {
+			backendFileAddrs = v.GetStringSlice("Backends")
+		}
+		backendFileMux.Unlock()
+		log.Printf("Backend file loaded: file=%s backends=%v", path, v.GetStringSlice("Backends"))
+	}
+	read()
+
+	// The directory is watched rather than the file, so that the file is
+	// still followed when it is replaced, as kubernetes does with the
+	// symlinks of mounted config maps.
+	w, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = w.Add(filepath.Dir(path))
+		if err != nil {
+			w.Close()
+		}
+	}
+	if err != nil {
+		log.Printf("Unable to watch backend file: file=%s error=%s", path, err)
+		return
+	}
+	backendFileMux.Lock()
+	if backendFile != path {
+		backendFileMux.Unlock()
+		w.Close()
+		return
+	}
+	backendFileWatcher = w
+	backendFileMux.Unlock()
+	go followBackendFile(w, path, read)
+}
+
+// followBackendFile calls read whenever the file at path, or the file its
+// symlinks resolve to, changes, until the watcher w is closed.
+func followBackendFile(w *fsnotify.Watcher, path string, read func()) {
+	clean := filepath.Clean(path)
+	resolved, _ := filepath.EvalSymlinks(path)
+	for {
+		select {
+		case e, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			current, _ := filepath.EvalSymlinks(path)
+			written := filepath.Clean(e.Name) == clean && e.Op&(fsnotify.Write|fsnotify.Create) != 0
+			if !written && (current == "" || current == resolved) {
+				continue
+			}
+			resolved = current
+			read()
+			refreshBackends(false)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Backend file watch failed: file=%s error=%s", path, err)
+		}
+	}
+}
+
+func fileBackends() []string {
+	backendFileMux.Lock()
+	defer backendFileMux.Unlock()
+	return append([]string{}, backendFileAddrs...)
+}
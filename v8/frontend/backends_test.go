@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/connectivity"
+)
+
+// Redialing replaces a backend, whose connection stays open until the RPCs
+// in flight on it are done.
+func TestBackendPoolRedial(t *testing.T) {
+	bp := newBackendPool()
+	bp.update([]string{"127.0.0.1:1"}, false)
+	old := bp.backends["127.0.0.1:1"]
+	old.online = true
+
+	if be := bp.acquire(context.Background(), 1); be != old {
+		t.Fatalf("acquire = %v, want the only backend", be)
+	}
+	bp.update([]string{"127.0.0.1:1"}, true)
+	be := bp.backends["127.0.0.1:1"]
+	if be == old {
+		t.Fatalf("redial kept the old backend")
+	}
+	if !be.online || old.online || !old.retired {
+		t.Errorf("after redial: new online=%v, old online=%v retired=%v", be.online, old.online, old.retired)
+	}
+	if old.conn.GetState() == connectivity.Shutdown {
+		t.Errorf("the connection of the old backend was closed with an RPC in flight")
+	}
+	bp.release(old)
+	if old.conn.GetState() != connectivity.Shutdown {
+		t.Errorf("the connection of the old backend is still open after its last RPC")
+	}
+
+	bp.update(nil, false)
+	if len(bp.backends) != 0 || be.conn.GetState() != connectivity.Shutdown {
+		t.Errorf("a removed idle backend was not closed")
+	}
+	if n, total := bp.online(); n != 0 || total != 0 {
+		t.Errorf("online = %d/%d, want 0/0", n, total)
+	}
+}
+
+// acquire stops waiting for a busy backend once its context is done.
+func TestBackendPoolAcquireCanceled(t *testing.T) {
+	bp := newBackendPool()
+	bp.update([]string{"127.0.0.1:1"}, false)
+	defer bp.update(nil, false)
+	bp.backends["127.0.0.1:1"].online = true
+
+	busy := bp.acquire(context.Background(), 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan *backend)
+	go func() { done <- bp.acquire(ctx, 1) }()
+	select {
+	case be := <-done:
+		if be != nil {
+			t.Errorf("acquire of a busy backend = %v, want nil", be)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("acquire kept waiting after its context was done")
+	}
+	bp.release(busy)
+	if be := bp.acquire(context.Background(), 1); be != busy {
+		t.Errorf("acquire after release = %v, want the backend", be)
+	}
+}
+
+// The backend file is followed until another one is configured, whose
+// changes are the only ones read from then on.
+func TestWatchBackendFile(t *testing.T) {
+	defer func(bp *backendPool) { backends = bp }(backends)
+	backends = newBackendPool()
+	defer backends.update(nil, false)
+	defer watchBackendFile("")
+
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.yml"), filepath.Join(dir, "second.yml")
+	write := func(path string, addr string) {
+		if err := ioutil.WriteFile(path, []byte("Backends: ["+addr+"]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor := func(addr string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if addrs := fileBackends(); len(addrs) == 1 && addrs[0] == addr {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("backend file backends = %v, want [%s]", fileBackends(), addr)
+	}
+
+	closed := func(w *fsnotify.Watcher) bool {
+		done := make(chan struct{})
+		go func() {
+			for range w.Events {
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+			return true
+		case <-time.After(5 * time.Second):
+			return false
+		}
+	}
+	watcher := func() *fsnotify.Watcher {
+		backendFileMux.Lock()
+		defer backendFileMux.Unlock()
+		return backendFileWatcher
+	}
+
+	write(first, "127.0.0.1:1")
+	write(second, "127.0.0.1:2")
+	watchBackendFile(first)
+	waitFor("127.0.0.1:1")
+	write(first, "127.0.0.1:3")
+	waitFor("127.0.0.1:3")
+
+	w := watcher()
+	watchBackendFile(second)
+	waitFor("127.0.0.1:2")
+	if !closed(w) {
+		t.Errorf("the watcher of a replaced backend file is still open")
+	}
+	write(first, "127.0.0.1:4")
+	time.Sleep(100 * time.Millisecond)
+	waitFor("127.0.0.1:2")
+}
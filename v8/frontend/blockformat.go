@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"math"
+
+	"github.com/hasiotis/mandelbrot/v8/packed"
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+)
+
+// Cached blocks are stored in a versioned binary format. A 16 byte header
+//
+//	magic     [4]byte "MBLK"
+//	version   uint8
+//	bitDepth  uint8   8, 16 or 32 bits per iteration count
+//	encoding  uint8   compression of the payload, a pb.Compression
+//	flags     uint8   blockSmooth when smooth counts follow
+//	width     uint16
+//	height    uint16
+//	checksum  uint32  CRC-32 (IEEE) of the uncompressed payload
+//
+// is followed by the payload: the width x height iteration counts in the
+// order of block.Rectangle, then for smooth blocks the float32 smooth
+// counts. Blocks on the edges of a frame are narrower or lower. All
+// integers are little endian. Entries written before the format existed
+// are JSON and are still decoded: full blocks of uint8 counts as the
+// original frontend cached them, and blocks of the JSON block struct.
+const (
+	blockFormatVersion uint8 = 1
+	blockHeaderSize    int   = 16
+	blockSmooth        uint8 = 1 << 0
+)
+
+var blockMagic = []byte("MBLK")
+
+// encodeBlock serializes a block in the binary cache format, with the
+// smallest bit depth that holds its counts.
+func encodeBlock(b block, c pb.Compression) ([]byte, error) {
+	width, height := b.size()
+	var maxCount uint32
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if b.Rectangle[x][y] > maxCount {
+				maxCount = b.Rectangle[x][y]
+			}
+		}
+	}
+	bitDepth := uint8(32)
+	if maxCount <= math.MaxInt32 {
+		bitDepth = uint8(packed.BitDepth(int32(maxCount)))
+	}
+	size := int(bitDepth / 8)
+
+	n := width * height
+	payloadSize := n * size
+	var flags uint8
+	if b.Smooth != nil {
+		flags |= blockSmooth
+		payloadSize += n * 4
+	}
+
+	payload := make([]byte, payloadSize)
+	off := 0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			r := b.Rectangle[x][y]
+			switch size {
+			case 1:
+				payload[off] = uint8(r)
+			case 2:
+				binary.LittleEndian.PutUint16(payload[off:], uint16(r))
+			case 4:
+				binary.LittleEndian.PutUint32(payload[off:], r)
+			}
+			off += size
+		}
+	}
+	if b.Smooth != nil {
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				binary.LittleEndian.PutUint32(payload[off:], math.Float32bits(b.Smooth[x][y]))
+				off += 4
+			}
+		}
+	}
+
+	compressed, err := packed.Compress(payload, c)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, blockHeaderSize, blockHeaderSize+len(compressed))
+	copy(data, blockMagic)
+	data[4] = blockFormatVersion
+	data[5] = bitDepth
+	data[6] = uint8(c)
+	data[7] = flags
+	binary.LittleEndian.PutUint16(data[8:], uint16(width))
+	binary.LittleEndian.PutUint16(data[10:], uint16(height))
+	binary.LittleEndian.PutUint32(data[12:], crc32.ChecksumIEEE(payload))
+	return append(data, compressed...), nil
+}
+
+// decodeBlock deserializes a cached block, either in the binary format or
+// in the legacy JSON one.
+func decodeBlock(data []byte) (block, error) {
+	var b block
+	if len(data) > 1 && data[0] == '[' && data[1] == '[' {
+		var legacy [blockSize][blockSize]uint8
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return b, err
+		}
+		for x := range legacy {
+			for y, r := range legacy[x] {
+				b.Rectangle[x][y] = uint32(r)
+			}
+		}
+		return b, nil
+	}
+	if len(data) > 0 && data[0] == '{' {
+		err := json.Unmarshal(data, &b)
+		return b, err
+	}
+
+	if len(data) < blockHeaderSize || string(data[:4]) != string(blockMagic) {
+		return b, fmt.Errorf("unknown block format")
+	}
+	if data[4] != blockFormatVersion {
+		return b, fmt.Errorf("unsupported block format version: %d", data[4])
+	}
+	bitDepth, c, flags := data[5], pb.Compression(data[6]), data[7]
+	width := int(binary.LittleEndian.Uint16(data[8:]))
+	height := int(binary.LittleEndian.Uint16(data[10:]))
+	if width < 1 || width > blockSize || height < 1 || height > blockSize {
+		return b, fmt.Errorf("unexpected block size: %dx%d", width, height)
+	}
+	b.width, b.height = width, height
+	size := int(bitDepth / 8)
+	if size != 1 && size != 2 && size != 4 {
+		return b, fmt.Errorf("unsupported bit depth: %d", bitDepth)
+	}
+
+	payload, err := packed.Decompress(data[blockHeaderSize:], c)
+	if err != nil {
+		return b, err
+	}
+	n := width * height
+	expected := n * size
+	if flags&blockSmooth != 0 {
+		expected += n * 4
+	}
+	if len(payload) != expected {
+		return b, fmt.Errorf("block payload of %d bytes, expected %d", len(payload), expected)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(data[12:]) {
+		return b, fmt.Errorf("block checksum mismatch")
+	}
+
+	off := 0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			switch size {
+			case 1:
+				b.Rectangle[x][y] = uint32(payload[off])
+			case 2:
+				b.Rectangle[x][y] = uint32(binary.LittleEndian.Uint16(payload[off:]))
+			case 4:
+				b.Rectangle[x][y] = binary.LittleEndian.Uint32(payload[off:])
+			}
+			off += size
+		}
+	}
+	if flags&blockSmooth != 0 {
+		b.Smooth = new([blockSize][blockSize]float32)
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				b.Smooth[x][y] = math.Float32frombits(binary.LittleEndian.Uint32(payload[off:]))
+				off += 4
+			}
+		}
+	}
+	return b, nil
+}
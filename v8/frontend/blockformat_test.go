@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+)
+
+// testBlock returns a block of width x height pixels whose counts go up to
+// maxCount.
+func testBlock(width int, height int, maxCount uint32, smooth bool) block {
+	b := block{width: width, height: height}
+	if smooth {
+		b.Smooth = new([blockSize][blockSize]float32)
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			b.Rectangle[x][y] = uint32(x*blockSize+y) * (maxCount / uint32(blockSize*blockSize))
+			if smooth {
+				b.Smooth[x][y] = float32(x) + float32(y)/64
+			}
+		}
+	}
+	b.Rectangle[width-1][height-1] = maxCount
+	return b
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	sizes := [][2]int{{blockSize, blockSize}, {7, blockSize}, {blockSize, 1}, {5, 3}}
+	depths := []struct {
+		maxCount uint32
+		bitDepth uint8
+	}{{200, 8}, {60000, 16}, {100000, 32}, {1<<32 - 1, 32}}
+	compressions := []pb.Compression{pb.Compression_NONE, pb.Compression_DEFLATE, pb.Compression_ZSTD}
+
+	for _, size := range sizes {
+		for _, depth := range depths {
+			for _, c := range compressions {
+				for _, smooth := range []bool{false, true} {
+					b := testBlock(size[0], size[1], depth.maxCount, smooth)
+					data, err := encodeBlock(b, c)
+					if err != nil {
+						t.Fatalf("encodeBlock %dx%d max=%d %s: %s", size[0], size[1], depth.maxCount, c, err)
+					}
+					if data[5] != depth.bitDepth {
+						t.Errorf("encodeBlock max=%d: bit depth %d, want %d", depth.maxCount, data[5], depth.bitDepth)
+					}
+					got, err := decodeBlock(data)
+					if err != nil {
+						t.Fatalf("decodeBlock %dx%d max=%d %s: %s", size[0], size[1], depth.maxCount, c, err)
+					}
+					if got.width != size[0] || got.height != size[1] {
+						t.Errorf("decodeBlock: size %dx%d, want %dx%d", got.width, got.height, size[0], size[1])
+					}
+					if got.Rectangle != b.Rectangle {
+						t.Errorf("decodeBlock %dx%d max=%d %s: counts differ", size[0], size[1], depth.maxCount, c)
+					}
+					if (got.Smooth != nil) != smooth || (smooth && *got.Smooth != *b.Smooth) {
+						t.Errorf("decodeBlock %dx%d max=%d %s: smooth counts differ", size[0], size[1], depth.maxCount, c)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeBlockErrors(t *testing.T) {
+	valid, err := encodeBlock(testBlock(blockSize, blockSize, 1000, true), pb.Compression_NONE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(f func(data []byte) []byte) []byte {
+		data := append([]byte(nil), valid...)
+		return f(data)
+	}
+	tests := map[string][]byte{
+		"empty":     nil,
+		"truncated": valid[:blockHeaderSize-1],
+		"magic":     corrupt(func(d []byte) []byte { d[0] = 'X'; return d }),
+		"version":   corrupt(func(d []byte) []byte { d[4] = blockFormatVersion + 1; return d }),
+		"bit depth": corrupt(func(d []byte) []byte { d[5] = 24; return d }),
+		"width":     corrupt(func(d []byte) []byte { d[8] = byte(blockSize + 1); return d }),
+		"height":    corrupt(func(d []byte) []byte { d[10] = 0; return d }),
+		"payload":   corrupt(func(d []byte) []byte { return d[:len(d)-1] }),
+		"checksum":  corrupt(func(d []byte) []byte { d[blockHeaderSize] ^= 1; return d }),
+		"legacy":    []byte(`[[256]]`),
+	}
+	for name, data := range tests {
+		if _, err := decodeBlock(data); err == nil {
+			t.Errorf("decodeBlock of a block with a bad %s succeeded", name)
+		}
+	}
+}
+
+// The original frontend cached the json.Marshal of the uint8 counts of
+// every full block.
+func TestDecodeLegacyBlock(t *testing.T) {
+	var r [blockSize][blockSize]uint8
+	for x := 0; x < blockSize; x++ {
+		for y := 0; y < blockSize; y++ {
+			r[x][y] = uint8(x*blockSize + y)
+		}
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[:5]) != "[[0,1" {
+		t.Fatalf("legacy entry starts with %q", data[:5])
+	}
+
+	b, err := decodeBlock(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width, height := b.size(); width != blockSize || height != blockSize {
+		t.Errorf("legacy block of %dx%d", width, height)
+	}
+	if b.Smooth != nil {
+		t.Errorf("legacy block with smooth counts")
+	}
+	for x := 0; x < blockSize; x++ {
+		for y := 0; y < blockSize; y++ {
+			if b.Rectangle[x][y] != uint32(r[x][y]) {
+				t.Fatalf("count %d,%d = %d, want %d", x, y, b.Rectangle[x][y], r[x][y])
+			}
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// BlockCache stores serialized blocks. key identifies a render, see
+// cacheKey, and blockid a block within it.
+type BlockCache interface {
+	Get(key string, blockid string) ([]byte, bool, error)
+	Set(key string, blockid string, data []byte) error
+	// Online reports whether the cache can currently be used.
+	Online() bool
+	Name() string
+}
+
+// connector is implemented by caches that talk to a server and have to
+// (re)connect to it. retry forces a new connection.
+type connector interface {
+	connect(retry bool)
+}
+
+// closer is implemented by caches holding connections, which are closed
+// once the cache is replaced.
+type closer interface {
+	close()
+}
+
+var (
+	cacheMux  sync.Mutex
+	cache     BlockCache
+	cacheSpec string
+)
+
+// setupCache builds the cache configured in C. The current cache, and
+// what it holds, is kept when its configuration did not change.
+func setupCache() {
+	spec := fmt.Sprintf("levels=%v memoryBytes=%d dir=%s diskBytes=%d redis=%s ttl=%s", C.Cache, C.CacheMemoryBytes, C.CacheDir, C.CacheDiskBytes, C.RedisServer, C.CacheTTL)
+
+	cacheMux.Lock()
+	defer cacheMux.Unlock()
+	if cache != nil && spec == cacheSpec {
+		return
+	}
+
+	var levels []BlockCache
+	for _, name := range C.Cache {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "memory":
+			levels = append(levels, newMemoryCache(C.CacheMemoryBytes))
+		case "redis":
+			levels = append(levels, &redisCache{client: &redisClient{server: C.RedisServer}, ttl: C.CacheTTL})
+		case "disk":
+			dc, err := newDiskCache(C.CacheDir, C.CacheDiskBytes)
+			if err != nil {
+				log.Printf("Disk cache disabled: dir=%s error=%s", C.CacheDir, err)
+				continue
+			}
+			levels = append(levels, dc)
+		case "", "none":
+		default:
+			log.Printf("Unknown cache level ignored: level=%s", name)
+		}
+	}
+	if cl, ok := cache.(closer); ok {
+		cl.close()
+	}
+	cache = &tieredCache{levels: levels}
+	cacheSpec = spec
+	log.Printf("Block cache: levels=%s", cache.Name())
+}
+
+func currentCache() BlockCache {
+	cacheMux.Lock()
+	defer cacheMux.Unlock()
+	return cache
+}
+
+// cacheOnline reports whether any cache level can be used.
+func cacheOnline() bool {
+	return currentCache().Online()
+}
+
+// cacheConnect connects the cache levels that talk to a server.
+func cacheConnect(retry bool) {
+	if cn, ok := currentCache().(connector); ok {
+		cn.connect(retry)
+	}
+}
+
+// tieredCache looks blocks up level by level, the first level being the
+// fastest, and copies hits into the levels before the one that had them.
+// Blocks are stored in every level.
+type tieredCache struct {
+	levels []BlockCache
+}
+
+func (tc *tieredCache) Get(key string, blockid string) ([]byte, bool, error) {
+	for n, l := range tc.levels {
+		if !l.Online() {
+			continue
+		}
+		data, ok, err := l.Get(key, blockid)
+		if err != nil {
+			log.Printf("Cache get failed: level=%s key=%s blockid=%s error=%s", l.Name(), key, blockid, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		for _, upper := range tc.levels[:n] {
+			if upper.Online() {
+				if err := upper.Set(key, blockid, data); err != nil {
+					log.Printf("Cache fill failed: level=%s key=%s blockid=%s error=%s", upper.Name(), key, blockid, err)
+				}
+			}
+		}
+		return data, true, nil
+	}
+	return nil, false, nil
+}
+
+func (tc *tieredCache) Set(key string, blockid string, data []byte) error {
+	var firstErr error
+	for _, l := range tc.levels {
+		if !l.Online() {
+			continue
+		}
+		if err := l.Set(key, blockid, data); err != nil {
+			log.Printf("Cache set failed: level=%s key=%s blockid=%s error=%s", l.Name(), key, blockid, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (tc *tieredCache) Online() bool {
+	for _, l := range tc.levels {
+		if l.Online() {
+			return true
+		}
+	}
+	return false
+}
+
+func (tc *tieredCache) Name() string {
+	if len(tc.levels) == 0 {
+		return "none"
+	}
+	names := make([]string, len(tc.levels))
+	for n, l := range tc.levels {
+		names[n] = l.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+func (tc *tieredCache) connect(retry bool) {
+	for _, l := range tc.levels {
+		if cn, ok := l.(connector); ok {
+			cn.connect(retry)
+		}
+	}
+}
+
+func (tc *tieredCache) close() {
+	for _, l := range tc.levels {
+		if cl, ok := l.(closer); ok {
+			cl.close()
+		}
+	}
+}
+
+// memoryCache is an in-process LRU cache holding at most maxBytes of
+// blocks.
+type memoryCache struct {
+	mux      sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type memoryEntry struct {
+	id   string
+	data []byte
+}
+
+func newMemoryCache(maxBytes int64) *memoryCache {
+	return &memoryCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (mc *memoryCache) Get(key string, blockid string) ([]byte, bool, error) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+
+	e, ok := mc.entries[key+"/"+blockid]
+	if !ok {
+		return nil, false, nil
+	}
+	mc.order.MoveToFront(e)
+	return e.Value.(*memoryEntry).data, true, nil
+}
+
+func (mc *memoryCache) Set(key string, blockid string, data []byte) error {
+	id := key + "/" + blockid
+	size := int64(len(id) + len(data))
+	if size > mc.maxBytes {
+		return nil
+	}
+
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+
+	if e, ok := mc.entries[id]; ok {
+		mc.remove(e)
+	}
+	mc.entries[id] = mc.order.PushFront(&memoryEntry{id: id, data: data})
+	mc.size += size
+	for mc.size > mc.maxBytes {
+		mc.remove(mc.order.Back())
+	}
+	return nil
+}
+
+func (mc *memoryCache) remove(e *list.Element) {
+	me := e.Value.(*memoryEntry)
+	mc.order.Remove(e)
+	delete(mc.entries, me.id)
+	mc.size -= int64(len(me.id) + len(me.data))
+}
+
+func (mc *memoryCache) Online() bool {
+	return true
+}
+
+func (mc *memoryCache) Name() string {
+	return "memory"
+}
+
+// diskCache stores every block in a file, dir/<key>/<blockid>. Once the
+// files take more than maxBytes, unbounded when 0, the least recently used
+// ones are removed until they take at most 90% of it. Blocks are written
+// and evicted holding the guard of their render directory, so that eviction
+// never removes a directory a block is being written to.
+type diskCache struct {
+	dir      string
+	maxBytes int64
+	guards   [64]sync.Mutex
+
+	mux      sync.Mutex
+	size     int64
+	evicting bool
+}
+
+func newDiskCache(dir string, maxBytes int64) (*diskCache, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no cache directory configured")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	dc := &diskCache{dir: dir, maxBytes: maxBytes}
+	files, err := dc.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		dc.size += f.size
+	}
+	return dc, nil
+}
+
+// path maps a block onto a file, avoiding characters that are not
+// portable in file names.
+func (dc *diskCache) path(key string, blockid string) string {
+	clean := strings.NewReplacer(":", "_", "/", "_", "\\", "_")
+	return filepath.Join(dc.dir, clean.Replace(key), clean.Replace(blockid))
+}
+
+// guard returns the guard of the render directory dir.
+func (dc *diskCache) guard(dir string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(dir))
+	return &dc.guards[h.Sum32()%uint32(len(dc.guards))]
+}
+
+// Get marks the blocks it reads as used by touching their files.
+func (dc *diskCache) Get(key string, blockid string) ([]byte, bool, error) {
+	path := dc.path(key, blockid)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return data, true, nil
+}
+
+// Set writes the block to a temporary file first, so readers never see a
+// partially written block.
+func (dc *diskCache) Set(key string, blockid string, data []byte) error {
+	path := dc.path(key, blockid)
+	g := dc.guard(filepath.Dir(path))
+	g.Lock()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		g.Unlock()
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".block-")
+	if err != nil {
+		g.Unlock()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		g.Unlock()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		g.Unlock()
+		return err
+	}
+	var replaced int64
+	if fi, err := os.Stat(path); err == nil {
+		replaced = fi.Size()
+	}
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	g.Unlock()
+	if err != nil {
+		return err
+	}
+
+	dc.mux.Lock()
+	dc.size += int64(len(data)) - replaced
+	evict := dc.maxBytes > 0 && dc.size > dc.maxBytes && !dc.evicting
+	if evict {
+		dc.evicting = true
+	}
+	dc.mux.Unlock()
+	if evict {
+		dc.evict()
+	}
+	return nil
+}
+
+type diskFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// files lists the block files below dir.
+func (dc *diskCache) files() ([]diskFile, error) {
+	var files []diskFile
+	err := filepath.Walk(dc.dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.Mode().IsRegular() && !strings.HasPrefix(fi.Name(), ".block-") {
+			files = append(files, diskFile{path: path, size: fi.Size(), modTime: fi.ModTime()})
+		}
+		return nil
+	})
+	return files, err
+}
+
+// evict removes the least recently used blocks until they take at most
+// 90% of maxBytes, along with the renders left without blocks. Blocks
+// stored or read since the directory was listed are kept.
+func (dc *diskCache) evict() {
+	defer func() {
+		dc.mux.Lock()
+		dc.evicting = false
+		dc.mux.Unlock()
+	}()
+
+	files, err := dc.files()
+	if err != nil {
+		log.Printf("Disk cache eviction failed: dir=%s error=%s", dc.dir, err)
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+	target := dc.maxBytes / 10 * 9
+	removed := 0
+	var freed int64
+	for _, f := range files {
+		if size <= target {
+			break
+		}
+		if dc.remove(f) {
+			size -= f.size
+			freed += f.size
+			removed++
+		}
+	}
+
+	dc.mux.Lock()
+	dc.size -= freed
+	dc.mux.Unlock()
+	log.Printf("Disk cache evicted: dir=%s blocks=%d size=%d", dc.dir, removed, size)
+}
+
+// remove removes the block file f unless it changed since it was listed,
+// and its render directory once it holds no other block.
+func (dc *diskCache) remove(f diskFile) bool {
+	dir := filepath.Dir(f.path)
+	g := dc.guard(dir)
+	g.Lock()
+	defer g.Unlock()
+
+	fi, err := os.Stat(f.path)
+	if err != nil || fi.Size() != f.size || !fi.ModTime().Equal(f.modTime) {
+		return false
+	}
+	if err := os.Remove(f.path); err != nil {
+		return false
+	}
+	os.Remove(dir)
+	return true
+}
+
+func (dc *diskCache) Online() bool {
+	return true
+}
+
+func (dc *diskCache) Name() string {
+	return "disk"
+}
+
+// redisCache stores the blocks of a render in a redis hash named after the
+// render, with a field per block. The hash expires ttl after the last block
+// was stored in it, never when ttl is 0.
+type redisCache struct {
+	client *redisClient
+	ttl    time.Duration
+}
+
+func (rc *redisCache) Get(key string, blockid string) ([]byte, bool, error) {
+	r := rc.client.cmd("HGET", key, blockid)
+	if r.Err != nil {
+		return nil, false, r.Err
+	}
+	if r.IsType(redis.Nil) {
+		return nil, false, nil
+	}
+	data, err := r.Bytes()
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (rc *redisCache) Set(key string, blockid string, data []byte) error {
+	if err := rc.client.cmd("HSET", key, blockid, data).Err; err != nil {
+		return err
+	}
+	if rc.ttl <= 0 {
+		return nil
+	}
+	return rc.client.cmd("EXPIRE", key, int64((rc.ttl+time.Second-1)/time.Second)).Err
+}
+
+func (rc *redisCache) Online() bool {
+	return rc.client.Online()
+}
+
+func (rc *redisCache) Name() string {
+	return "redis"
+}
+
+func (rc *redisCache) connect(retry bool) {
+	rc.client.connect(retry)
+}
+
+func (rc *redisCache) close() {
+	rc.client.close()
+}
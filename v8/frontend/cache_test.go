@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	dc, err := newDiskCache(dir, 10*1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte{1}, 1000)
+
+	// Blocks 0 to 9 fill the cache, block 0 is read again after all of
+	// them were stored, so block 1 is the least recently used.
+	start := time.Now().Add(-time.Hour)
+	for n := 0; n < 10; n++ {
+		id := fmt.Sprintf("%d:0", n)
+		if err := dc.Set("mandel:test", id, data); err != nil {
+			t.Fatal(err)
+		}
+		at := start.Add(time.Duration(n) * time.Minute)
+		os.Chtimes(dc.path("mandel:test", id), at, at)
+	}
+	if _, ok, err := dc.Get("mandel:test", "0:0"); !ok || err != nil {
+		t.Fatalf("Get of a stored block: %v %v", ok, err)
+	}
+	if dc.size != 10*1000 {
+		t.Errorf("size = %d, want %d", dc.size, 10*1000)
+	}
+
+	if err := dc.Set("mandel:other", "0:0", data); err != nil {
+		t.Fatal(err)
+	}
+	if dc.size > 9*1000 {
+		t.Errorf("size after eviction = %d, want at most %d", dc.size, 9*1000)
+	}
+	for id, want := range map[string]bool{"0:0": true, "1:0": false, "2:0": false, "3:0": true, "9:0": true} {
+		if _, ok, _ := dc.Get("mandel:test", id); ok != want {
+			t.Errorf("block %s cached = %v, want %v", id, ok, want)
+		}
+	}
+	if _, ok, _ := dc.Get("mandel:other", "0:0"); !ok {
+		t.Errorf("the block just stored was evicted")
+	}
+
+	// A new cache on the same directory picks up what it holds.
+	reopened, err := newDiskCache(dir, 10*1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.size != dc.size {
+		t.Errorf("size of the reopened cache = %d, want %d", reopened.size, dc.size)
+	}
+}
+
+func TestDiskCacheReplace(t *testing.T) {
+	dc, err := newDiskCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc.Set("mandel:test", "0:0", make([]byte, 100))
+	dc.Set("mandel:test", "0:0", make([]byte, 40))
+	if dc.size != 40 {
+		t.Errorf("size = %d, want 40", dc.size)
+	}
+	data, ok, err := dc.Get("mandel:test", "0:0")
+	if !ok || err != nil || len(data) != 40 {
+		t.Errorf("Get = %d bytes %v %v, want the block stored last", len(data), ok, err)
+	}
+}
+
+func TestDiskCacheRemove(t *testing.T) {
+	dc, err := newDiskCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc.Set("mandel:test", "0:0", make([]byte, 100))
+	dc.Set("mandel:test", "1:0", make([]byte, 100))
+	files, err := dc.files()
+	if err != nil || len(files) != 2 {
+		t.Fatalf("files = %v %v", files, err)
+	}
+
+	// A block stored again since it was listed is kept.
+	changed := files[0]
+	dc.Set("mandel:test", filepath.Base(changed.path), make([]byte, 40))
+	if dc.remove(changed) {
+		t.Errorf("remove of a block stored since it was listed succeeded")
+	}
+	if !dc.remove(files[1]) {
+		t.Errorf("remove of an unchanged block failed")
+	}
+	if _, err := os.Stat(filepath.Dir(changed.path)); err != nil {
+		t.Errorf("render directory removed while it holds a block: %s", err)
+	}
+}
+
+// Blocks stored while the cache evicts are never lost to the removal of
+// their render directory.
+func TestDiskCacheConcurrentEviction(t *testing.T) {
+	dc, err := newDiskCache(t.TempDir(), 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				if err := dc.Set(fmt.Sprintf("mandel:%d", n%3), fmt.Sprintf("%d:%d", w, n), make([]byte, 100)); err != nil {
+					t.Errorf("Set while evicting: %s", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	files, err := dc.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+	if dc.size != size {
+		t.Errorf("size = %d, the files take %d", dc.size, size)
+	}
+}
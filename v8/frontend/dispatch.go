@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// blockPos is the position of a block in the grid of blocks of a frame.
+type blockPos struct {
+	x int
+	y int
+}
+
+// blockOrder returns every block of a cols x rows grid in the order the
+// blocks are rendered, so the most important blocks finish first.
+func blockOrder(order string, cols int, rows int) []blockPos {
+	switch strings.ToLower(order) {
+	case "spiral":
+		return spiralOrder(cols, rows)
+	case "hilbert":
+		return hilbertOrder(cols, rows)
+	}
+	return rowMajorOrder(cols, rows)
+}
+
+func rowMajorOrder(cols int, rows int) []blockPos {
+	blocks := make([]blockPos, 0, cols*rows)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			blocks = append(blocks, blockPos{x, y})
+		}
+	}
+	return blocks
+}
+
+// spiralOrder walks a square spiral outwards from the center block,
+// skipping the positions that fall outside the grid.
+func spiralOrder(cols int, rows int) []blockPos {
+	blocks := make([]blockPos, 0, cols*rows)
+	x, y := (cols-1)/2, (rows-1)/2
+	dirs := [4]blockPos{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+	add := func() {
+		if x >= 0 && x < cols && y >= 0 && y < rows {
+			blocks = append(blocks, blockPos{x, y})
+		}
+	}
+
+	add()
+	for leg := 0; len(blocks) < cols*rows; leg++ {
+		d := dirs[leg%4]
+		for n := 0; n < leg/2+1; n++ {
+			x, y = x+d.x, y+d.y
+			add()
+		}
+	}
+	return blocks
+}
+
+// hilbertOrder follows a Hilbert curve over the smallest power of two
+// square that holds the grid, which keeps consecutive blocks close.
+func hilbertOrder(cols int, rows int) []blockPos {
+	side := 1
+	for side < cols || side < rows {
+		side *= 2
+	}
+
+	blocks := make([]blockPos, 0, cols*rows)
+	for d := 0; d < side*side; d++ {
+		x, y := hilbertPoint(side, d)
+		if x < cols && y < rows {
+			blocks = append(blocks, blockPos{x, y})
+		}
+	}
+	return blocks
+}
+
+// hilbertPoint returns the position of the d-th point of the Hilbert curve
+// filling a side x side square.
+func hilbertPoint(side int, d int) (int, int) {
+	x, y := 0, 0
+	for s := 1; s < side; s *= 2 {
+		rx := 1 & (d / 2)
+		ry := 1 & (d ^ rx)
+		if ry == 0 {
+			if rx == 1 {
+				x, y = s-1-x, s-1-y
+			}
+			x, y = y, x
+		}
+		x += s * rx
+		y += s * ry
+		d /= 4
+	}
+	return x, y
+}
+
+// limiter bounds the number of concurrent operations.
+type limiter chan struct{}
+
+func newLimiter(n int) limiter {
+	if n < 1 {
+		n = 1
+	}
+	return make(limiter, n)
+}
+
+// acquire waits for the limiter, unless ctx is done first, in which case
+// it returns the error of ctx.
+func (l limiter) acquire(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l limiter) release() {
+	<-l
+}
+
+var (
+	limitersMux sync.Mutex
+	cacheLimit  limiter
+	localLimit  limiter
+	jobLimit    limiter
+)
+
+// setupLimiters sizes the limiters after the configuration. Operations
+// already running release the limiter they acquired.
+func setupLimiters() {
+	limitersMux.Lock()
+	defer limitersMux.Unlock()
+
+	if cacheLimit == nil || cap(cacheLimit) != C.CacheConcurrency {
+		cacheLimit = newLimiter(C.CacheConcurrency)
+	}
+	if localLimit == nil || cap(localLimit) != localWorkers() {
+		localLimit = newLimiter(localWorkers())
+	}
+	if jobLimit == nil || cap(jobLimit) != C.MaxJobs {
+		jobLimit = newLimiter(C.MaxJobs)
+	}
+	log.Printf("Dispatch: BlockOrder=%s MaxInflight=%d BlocksPerRPC=%d CacheConcurrency=%d", C.BlockOrder, C.MaxInflight, C.BlocksPerRPC, C.CacheConcurrency)
+}
+
+// currentCacheLimiter returns the limiter of cache I/O.
+func currentCacheLimiter() limiter {
+	limitersMux.Lock()
+	defer limitersMux.Unlock()
+	return cacheLimit
+}
+
+// currentLocalLimiter returns the limiter of blocks computed in-process.
+func currentLocalLimiter() limiter {
+	limitersMux.Lock()
+	defer limitersMux.Unlock()
+	return localLimit
+}
+
+// currentJobLimiter returns the limiter of the jobs rendered at once.
+func currentJobLimiter() limiter {
+	limitersMux.Lock()
+	defer limitersMux.Unlock()
+	return jobLimit
+}
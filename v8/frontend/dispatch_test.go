@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+// Every order visits each block of the grid exactly once.
+func TestBlockOrderComplete(t *testing.T) {
+	grids := [][2]int{{1, 1}, {1, 7}, {7, 1}, {2, 2}, {3, 5}, {8, 8}, {9, 4}, {64, 33}}
+	for _, order := range []string{"rowmajor", "spiral", "hilbert", "Spiral", "unknown"} {
+		for _, grid := range grids {
+			cols, rows := grid[0], grid[1]
+			blocks := blockOrder(order, cols, rows)
+			if len(blocks) != cols*rows {
+				t.Errorf("%s %dx%d: %d blocks, want %d", order, cols, rows, len(blocks), cols*rows)
+			}
+			seen := make(map[blockPos]bool)
+			for _, bp := range blocks {
+				if bp.x < 0 || bp.x >= cols || bp.y < 0 || bp.y >= rows {
+					t.Errorf("%s %dx%d: block %v outside the grid", order, cols, rows, bp)
+				}
+				if seen[bp] {
+					t.Errorf("%s %dx%d: block %v visited twice", order, cols, rows, bp)
+				}
+				seen[bp] = true
+			}
+		}
+	}
+}
+
+func TestBlockOrderStart(t *testing.T) {
+	if bp := blockOrder("rowmajor", 5, 3)[1]; bp != (blockPos{1, 0}) {
+		t.Errorf("rowmajor: second block %v, want {1 0}", bp)
+	}
+	if bp := blockOrder("spiral", 5, 3)[0]; bp != (blockPos{2, 1}) {
+		t.Errorf("spiral: first block %v, want the center {2 1}", bp)
+	}
+	// Consecutive blocks of a Hilbert curve over a power of two square are
+	// neighbours.
+	blocks := blockOrder("hilbert", 8, 8)
+	for n := 1; n < len(blocks); n++ {
+		dx, dy := blocks[n].x-blocks[n-1].x, blocks[n].y-blocks[n-1].y
+		if dx*dx+dy*dy != 1 {
+			t.Errorf("hilbert: block %v follows %v", blocks[n], blocks[n-1])
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// explorerPage is the interactive explorer, a single page rendering its
+// views with /render and the previews of Julia sets with /julia.
+//
+//go:embed explorer.html
+var explorerPage []byte
+
+// wantsExplorer reports whether a request for / comes from a browser, which
+// gets the explorer instead of the default render when Explorer is on.
+func wantsExplorer(r *http.Request) bool {
+	return C.Explorer && r.URL.Path == "/" && r.URL.RawQuery == "" && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func explorerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(explorerPage)))
+	w.Write(explorerPage)
+}
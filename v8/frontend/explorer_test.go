@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWantsExplorer(t *testing.T) {
+	defer func(on bool) { C.Explorer = on }(C.Explorer)
+
+	tests := []struct {
+		url      string
+		accept   string
+		explorer bool
+		want     bool
+	}{
+		{"/", "text/html,application/xhtml+xml", true, true},
+		{"/", "text/html", false, false},
+		{"/", "*/*", true, false},
+		{"/", "", true, false},
+		{"/?width=256", "text/html", true, false},
+		{"/render", "text/html", true, false},
+	}
+	for _, tt := range tests {
+		C.Explorer = tt.explorer
+		r := httptest.NewRequest("GET", tt.url, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := wantsExplorer(r); got != tt.want {
+			t.Errorf("%s Accept=%q Explorer=%v: wantsExplorer = %v, want %v", tt.url, tt.accept, tt.explorer, got, tt.want)
+		}
+	}
+}
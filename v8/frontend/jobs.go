@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+	// jobLost is reported for jobs whose replica stopped updating them.
+	jobLost = "lost"
+)
+
+const (
+	// defaultJobTTL is the time jobs are kept for by default.
+	defaultJobTTL = time.Hour
+	// defaultJobStoreBytes bounds the results kept in memory by default.
+	defaultJobStoreBytes = 256 << 20
+	// jobUpdateInterval is the interval the progress of running jobs is
+	// written to the store and cancel requests are checked at.
+	jobUpdateInterval = time.Second
+	// jobStaleAfter is the time after which a job that is not updated
+	// any more is considered lost.
+	jobStaleAfter = 30 * time.Second
+)
+
+// jobState is the state of a render job as stored and reported by GET
+// /jobs/{id}. ETASeconds estimates the time left from the rate blocks are
+// computed at, once some were. FailedBlocks lists the blocks missing from
+// a partial result as x:y block coordinates.
+type jobState struct {
+	ID           string     `json:"id"`
+	Status       string     `json:"status"`
+	Query        string     `json:"query"`
+	Replica      string     `json:"replica"`
+	BlocksTotal  int        `json:"blocksTotal"`
+	BlocksDone   int        `json:"blocksDone"`
+	CacheHits    int        `json:"cacheHits"`
+	FailedBlocks []string   `json:"failedBlocks,omitempty"`
+	ETASeconds   *float64   `json:"etaSeconds,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	Created      time.Time  `json:"created"`
+	Started      *time.Time `json:"started,omitempty"`
+	Finished     *time.Time `json:"finished,omitempty"`
+	Updated      time.Time  `json:"updated"`
+}
+
+func (st jobState) finished() bool {
+	return st.Status == jobDone || st.Status == jobFailed || st.Status == jobCanceled
+}
+
+// jobProgress tracks a job running on this replica.
+type jobProgress struct {
+	mux      sync.Mutex
+	state    jobState
+	computed int
+}
+
+// observe counts the blocks of the render of the job.
+func (jp *jobProgress) observe(bp blockPos, b block, cached bool) {
+	jp.mux.Lock()
+	defer jp.mux.Unlock()
+	jp.state.BlocksDone++
+	if cached {
+		jp.state.CacheHits++
+	} else {
+		jp.computed++
+	}
+}
+
+// snapshot returns the current state of the job with its ETA.
+func (jp *jobProgress) snapshot() jobState {
+	jp.mux.Lock()
+	defer jp.mux.Unlock()
+	st := jp.state
+	st.Updated = time.Now()
+	st.ETASeconds = nil
+	if st.Status == jobRunning && jp.computed > 0 && st.Started != nil {
+		rate := float64(jp.computed) / time.Since(*st.Started).Seconds()
+		eta := float64(st.BlocksTotal-st.BlocksDone) / rate
+		st.ETASeconds = &eta
+	}
+	return st
+}
+
+func (jp *jobProgress) update(f func(st *jobState)) {
+	jp.mux.Lock()
+	defer jp.mux.Unlock()
+	f(&jp.state)
+}
+
+// jobRetryAfter is the delay clients are asked to wait for before
+// starting a job again when this replica holds MaxQueuedJobs.
+const jobRetryAfter = 30 * time.Second
+
+// runningJobs holds the cancel functions of the jobs queued or running on
+// this replica.
+var (
+	runningJobsMux sync.Mutex
+	runningJobs    = make(map[string]context.CancelFunc)
+)
+
+// admitJob registers job id as queued on this replica and returns the
+// context it runs with, unless MaxQueuedJobs jobs are queued or running.
+func admitJob(id string) (context.Context, bool) {
+	runningJobsMux.Lock()
+	defer runningJobsMux.Unlock()
+	if len(runningJobs) >= C.MaxQueuedJobs {
+		return nil, false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	runningJobs[id] = cancel
+	return ctx, true
+}
+
+// forgetJob cancels the context of job id and drops it from the jobs of
+// this replica.
+func forgetJob(id string) {
+	runningJobsMux.Lock()
+	defer runningJobsMux.Unlock()
+	if cancel, ok := runningJobs[id]; ok {
+		cancel()
+		delete(runningJobs, id)
+	}
+}
+
+// cancelRunningJob cancels job id if it runs on this replica.
+func cancelRunningJob(id string) bool {
+	runningJobsMux.Lock()
+	defer runningJobsMux.Unlock()
+	cancel, ok := runningJobs[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// runJob renders a job admitted with ctx and stores its result. It waits
+// for one of the MaxJobs slots of this replica, writes the progress to the
+// store every jobUpdateInterval and stops when the job is canceled on any
+// replica.
+func runJob(ctx context.Context, rr renderRequest, co colorOptions, st jobState) {
+	defer forgetJob(st.ID)
+
+	store := currentJobStore()
+	jp := &jobProgress{state: st}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(jobUpdateInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			if canceled, err := store.Canceled(st.ID); err == nil && canceled {
+				cancelRunningJob(st.ID)
+			}
+			if err := store.Put(jp.snapshot()); err != nil {
+				log.Printf("Job update failed: id=%s error=%s", st.ID, err)
+			}
+		}
+	}()
+
+	var (
+		fr  *frame
+		err error
+	)
+	lim := currentJobLimiter()
+	if err = lim.acquire(ctx); err == nil {
+		jp.update(func(st *jobState) {
+			now := time.Now()
+			st.Status, st.Started = jobRunning, &now
+		})
+		fr, err = calculateMandel(ctx, rr, jp.observe)
+		lim.release()
+	}
+	close(done)
+	wg.Wait()
+
+	if err == nil {
+		buffer := new(bytes.Buffer)
+		if err = png.Encode(buffer, frameImage(fr, co)); err == nil {
+			err = store.SetResult(st.ID, buffer.Bytes())
+		}
+	}
+	jp.update(func(st *jobState) {
+		now := time.Now()
+		st.Finished = &now
+		switch {
+		case err == context.Canceled:
+			st.Status = jobCanceled
+		case err != nil:
+			st.Status, st.Error = jobFailed, err.Error()
+		default:
+			st.Status = jobDone
+			if len(fr.failed) > 0 {
+				st.FailedBlocks = failedBlocks(fr.failed)
+			}
+		}
+	})
+	final := jp.snapshot()
+	if err := store.Put(final); err != nil {
+		log.Printf("Job update failed: id=%s error=%s", st.ID, err)
+	}
+	log.Printf("Job finished: id=%s status=%s blocks=%d/%d cacheHits=%d", final.ID, final.Status, final.BlocksDone, final.BlocksTotal, final.CacheHits)
+}
+
+// jobsHandler starts a render job with POST /jobs, the render parameters
+// given in the query or the form. It replies 202 with the state of the
+// job, which is polled at GET /jobs/{id}, 429 when this replica holds
+// MaxQueuedJobs already and 503 when the job store is full.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rr, co, err := queryRenderRequest(r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !renderReady(w) {
+		return
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	replica, _ := os.Hostname()
+	cols, rows := blockGrid(rr.width, rr.height)
+	now := time.Now()
+	st := jobState{
+		ID:          id,
+		Status:      jobQueued,
+		Query:       r.Form.Encode(),
+		Replica:     replica,
+		BlocksTotal: cols * rows,
+		Created:     now,
+		Updated:     now,
+	}
+	store := currentJobStore()
+	if bs, ok := store.(boundedStore); ok && bs.full() {
+		log.Printf("Job refused: the job store is full")
+		http.Error(w, errJobStoreFull.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	ctx, ok := admitJob(id)
+	if !ok {
+		log.Printf("Job refused: MaxQueuedJobs=%d jobs are queued or running", C.MaxQueuedJobs)
+		w.Header().Set("Retry-After", strconv.Itoa(int(jobRetryAfter/time.Second)))
+		http.Error(w, "too many jobs, retry later", http.StatusTooManyRequests)
+		return
+	}
+	if err := store.Put(st); err != nil {
+		forgetJob(id)
+		http.Error(w, fmt.Sprintf("unable to store job: %s", err), http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("Job queued: id=%s query=%s", id, st.Query)
+	go runJob(ctx, rr, co, st)
+
+	w.Header().Set("Location", "/jobs/"+id)
+	writeJobState(w, st, http.StatusAccepted)
+}
+
+// jobHandler reports the state of a job with GET /jobs/{id}, sends its
+// image with GET /jobs/{id}/result and cancels it, or deletes it once it
+// finished, with DELETE /jobs/{id}.
+func jobHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	id := parts[0]
+	if id == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "result") {
+		http.NotFound(w, r)
+		return
+	}
+
+	store := currentJobStore()
+	st, found, err := store.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if !found {
+		http.Error(w, "unknown job", http.StatusNotFound)
+		return
+	}
+	if !st.finished() && time.Since(st.Updated) > jobStaleAfter {
+		st.Status = jobLost
+		st.Error = fmt.Sprintf("replica %s stopped updating the job", st.Replica)
+	}
+
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		sendJobResult(w, store, st)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJobState(w, st, http.StatusOK)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if st.finished() || st.Status == jobLost {
+			if err := store.Delete(id); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err := store.Cancel(id); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		cancelRunningJob(id)
+		log.Printf("Job cancel requested: id=%s", id)
+		writeJobState(w, st, http.StatusAccepted)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// sendJobResult sends the image of a finished job, marked as a partial
+// frame when blocks are missing from it.
+func sendJobResult(w http.ResponseWriter, store JobStore, st jobState) {
+	if st.Status != jobDone {
+		http.Error(w, fmt.Sprintf("job is %s", st.Status), http.StatusConflict)
+		return
+	}
+	data, found, err := store.Result(st.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if !found {
+		http.Error(w, "job result expired", http.StatusNotFound)
+		return
+	}
+	if len(st.FailedBlocks) > 0 {
+		setPartialHeaders(w, st.FailedBlocks)
+	}
+	sendPNG(w, data, http.StatusOK)
+}
+
+func writeJobState(w http.ResponseWriter, st jobState, code int) {
+	data, err := json.MarshalIndent(&st, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
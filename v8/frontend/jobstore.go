@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// JobStore keeps the state and the result of render jobs. A store shared
+// by the replicas, such as redis, lets any of them answer for a job and
+// cancel it. Entries expire JobTTL after they were last written.
+type JobStore interface {
+	Put(st jobState) error
+	Get(id string) (jobState, bool, error)
+	SetResult(id string, data []byte) error
+	Result(id string) ([]byte, bool, error)
+	// Cancel asks the replica running the job to stop it, Canceled
+	// reports whether that was asked.
+	Cancel(id string) error
+	Canceled(id string) (bool, error)
+	Delete(id string) error
+	Online() bool
+	Name() string
+}
+
+// errJobStoreFull is returned when storing a result would take a store
+// past its size bound.
+var errJobStoreFull = errors.New("job store is full")
+
+// boundedStore is implemented by job stores that hold a bounded amount of
+// results, which report whether they are full.
+type boundedStore interface {
+	full() bool
+}
+
+var (
+	jobStoreMux  sync.Mutex
+	jobStore     JobStore
+	jobStoreSpec string
+)
+
+// setupJobStore builds the job store configured in C. The current store,
+// and the jobs it holds, is kept when its configuration did not change.
+func setupJobStore() {
+	spec := fmt.Sprintf("store=%s ttl=%s bytes=%d redis=%s", C.JobStore, C.JobTTL, C.JobStoreBytes, C.RedisServer)
+
+	jobStoreMux.Lock()
+	defer jobStoreMux.Unlock()
+	if jobStore != nil && spec == jobStoreSpec {
+		return
+	}
+
+	if cl, ok := jobStore.(closer); ok {
+		cl.close()
+	}
+	switch strings.ToLower(strings.TrimSpace(C.JobStore)) {
+	case "redis":
+		jobStore = &redisJobStore{client: &redisClient{server: C.RedisServer}, ttl: C.JobTTL}
+	case "memory":
+		jobStore = newMemoryJobStore(C.JobTTL, C.JobStoreBytes)
+	default:
+		log.Printf("Unknown job store, keeping jobs in memory: JobStore=%s", C.JobStore)
+		jobStore = newMemoryJobStore(C.JobTTL, C.JobStoreBytes)
+	}
+	jobStoreSpec = spec
+	log.Printf("Job store: store=%s ttl=%s", jobStore.Name(), C.JobTTL)
+}
+
+func currentJobStore() JobStore {
+	jobStoreMux.Lock()
+	defer jobStoreMux.Unlock()
+	return jobStore
+}
+
+// jobStoreConnect connects job stores that talk to a server.
+func jobStoreConnect(retry bool) {
+	if cn, ok := currentJobStore().(connector); ok {
+		cn.connect(retry)
+	}
+}
+
+// memoryJobStore keeps the jobs of this replica only, with up to maxBytes
+// of results. size is the total size of the results held.
+type memoryJobStore struct {
+	ttl      time.Duration
+	maxBytes int64
+	mux      sync.Mutex
+	jobs     map[string]*memoryJob
+	size     int64
+}
+
+type memoryJob struct {
+	state    jobState
+	result   []byte
+	canceled bool
+	expires  time.Time
+}
+
+func newMemoryJobStore(ttl time.Duration, maxBytes int64) *memoryJobStore {
+	return &memoryJobStore{ttl: ttl, maxBytes: maxBytes, jobs: make(map[string]*memoryJob)}
+}
+
+// job returns the job id, creating it when create is set. Expired jobs are
+// dropped on the way. It is called with the lock held.
+func (ms *memoryJobStore) job(id string, create bool) *memoryJob {
+	now := time.Now()
+	for jid, j := range ms.jobs {
+		if now.After(j.expires) {
+			ms.size -= int64(len(j.result))
+			delete(ms.jobs, jid)
+		}
+	}
+	j := ms.jobs[id]
+	if j == nil && create {
+		j = &memoryJob{}
+		ms.jobs[id] = j
+	}
+	if j != nil {
+		j.expires = now.Add(ms.ttl)
+	}
+	return j
+}
+
+func (ms *memoryJobStore) Put(st jobState) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	ms.job(st.ID, true).state = st
+	return nil
+}
+
+func (ms *memoryJobStore) Get(id string) (jobState, bool, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	j := ms.jobs[id]
+	if j == nil || time.Now().After(j.expires) {
+		return jobState{}, false, nil
+	}
+	return j.state, true, nil
+}
+
+func (ms *memoryJobStore) SetResult(id string, data []byte) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	j := ms.job(id, true)
+	size := ms.size - int64(len(j.result)) + int64(len(data))
+	if size > ms.maxBytes {
+		return errJobStoreFull
+	}
+	j.result, ms.size = data, size
+	return nil
+}
+
+func (ms *memoryJobStore) Result(id string) ([]byte, bool, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	j := ms.jobs[id]
+	if j == nil || j.result == nil || time.Now().After(j.expires) {
+		return nil, false, nil
+	}
+	return j.result, true, nil
+}
+
+func (ms *memoryJobStore) Cancel(id string) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	if j := ms.job(id, false); j != nil {
+		j.canceled = true
+	}
+	return nil
+}
+
+func (ms *memoryJobStore) Canceled(id string) (bool, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	j := ms.jobs[id]
+	return j != nil && j.canceled, nil
+}
+
+func (ms *memoryJobStore) Delete(id string) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	if j := ms.jobs[id]; j != nil {
+		ms.size -= int64(len(j.result))
+		delete(ms.jobs, id)
+	}
+	return nil
+}
+
+// full reports whether the results held, once the expired ones are
+// dropped, reached maxBytes.
+func (ms *memoryJobStore) full() bool {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	ms.job("", false)
+	return ms.size >= ms.maxBytes
+}
+
+func (ms *memoryJobStore) Online() bool {
+	return true
+}
+
+func (ms *memoryJobStore) Name() string {
+	return "memory"
+}
+
+// redisJobStore keeps jobs in redis, shared by every replica: the state as
+// JSON under job:<id>, the encoded image under job:<id>:result and the
+// cancel request under job:<id>:cancel.
+type redisJobStore struct {
+	client *redisClient
+	ttl    time.Duration
+}
+
+func jobKey(id string, suffix string) string {
+	if suffix == "" {
+		return "job:" + id
+	}
+	return "job:" + id + ":" + suffix
+}
+
+// set stores a value that expires after the TTL of the store.
+func (rs *redisJobStore) set(key string, v interface{}) error {
+	return rs.client.cmd("SET", key, v, "EX", int64(rs.ttl/time.Second)).Err
+}
+
+func (rs *redisJobStore) Put(st jobState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return rs.set(jobKey(st.ID, ""), data)
+}
+
+func (rs *redisJobStore) Get(id string) (jobState, bool, error) {
+	var st jobState
+	data, found, err := rs.get(jobKey(id, ""))
+	if err != nil || !found {
+		return st, false, err
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, false, err
+	}
+	return st, true, nil
+}
+
+func (rs *redisJobStore) get(key string) ([]byte, bool, error) {
+	r := rs.client.cmd("GET", key)
+	if r.Err != nil {
+		return nil, false, r.Err
+	}
+	if r.IsType(redis.Nil) {
+		return nil, false, nil
+	}
+	data, err := r.Bytes()
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (rs *redisJobStore) SetResult(id string, data []byte) error {
+	return rs.set(jobKey(id, "result"), data)
+}
+
+func (rs *redisJobStore) Result(id string) ([]byte, bool, error) {
+	return rs.get(jobKey(id, "result"))
+}
+
+func (rs *redisJobStore) Cancel(id string) error {
+	return rs.set(jobKey(id, "cancel"), 1)
+}
+
+func (rs *redisJobStore) Canceled(id string) (bool, error) {
+	n, err := rs.client.cmd("EXISTS", jobKey(id, "cancel")).Int()
+	return n > 0, err
+}
+
+func (rs *redisJobStore) Delete(id string) error {
+	return rs.client.cmd("DEL", jobKey(id, ""), jobKey(id, "result"), jobKey(id, "cancel")).Err
+}
+
+func (rs *redisJobStore) Online() bool {
+	return rs.client.Online()
+}
+
+func (rs *redisJobStore) Name() string {
+	return "redis"
+}
+
+func (rs *redisJobStore) connect(retry bool) {
+	rs.client.connect(retry)
+}
+
+func (rs *redisJobStore) close() {
+	rs.client.close()
+}
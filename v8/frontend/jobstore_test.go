@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// The memory store refuses results past its bound, and frees the space of
+// the jobs deleted.
+func TestMemoryJobStoreBytes(t *testing.T) {
+	ms := newMemoryJobStore(time.Hour, 10)
+	if err := ms.SetResult("a", make([]byte, 6)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.SetResult("b", make([]byte, 6)); err != errJobStoreFull {
+		t.Errorf("result past the bound: %v, want %v", err, errJobStoreFull)
+	}
+	if ms.full() {
+		t.Errorf("store of 6 of 10 bytes is full")
+	}
+	if err := ms.SetResult("a", make([]byte, 10)); err != nil {
+		t.Errorf("replacing a result: %v", err)
+	}
+	if !ms.full() {
+		t.Errorf("store of 10 of 10 bytes is not full")
+	}
+	if err := ms.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if ms.full() || ms.size != 0 {
+		t.Errorf("store holds %d bytes after the delete", ms.size)
+	}
+	if err := ms.SetResult("b", make([]byte, 6)); err != nil {
+		t.Errorf("result after the delete: %v", err)
+	}
+}
+
+func TestMemoryJobStoreExpiry(t *testing.T) {
+	ms := newMemoryJobStore(time.Millisecond, 10)
+	if err := ms.SetResult("a", make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if ms.full() || ms.size != 0 {
+		t.Errorf("store holds %d bytes of expired results", ms.size)
+	}
+}
+
+func TestAdmitJob(t *testing.T) {
+	defer func(n int) { C.MaxQueuedJobs = n }(C.MaxQueuedJobs)
+	C.MaxQueuedJobs = 2
+
+	ctx, ok := admitJob("a")
+	if !ok {
+		t.Fatal("first job refused")
+	}
+	defer forgetJob("a")
+	if _, ok := admitJob("b"); !ok {
+		t.Fatal("second job refused")
+	}
+	if _, ok := admitJob("c"); ok {
+		forgetJob("c")
+		t.Errorf("job past MaxQueuedJobs admitted")
+	}
+	forgetJob("b")
+	if _, ok := admitJob("c"); !ok {
+		t.Errorf("job refused once another finished")
+	}
+	forgetJob("c")
+
+	if !cancelRunningJob("a") || ctx.Err() == nil {
+		t.Errorf("canceling an admitted job left its context running")
+	}
+}
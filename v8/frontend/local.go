@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/hasiotis/mandelbrot/v8/compute"
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// localCompute reports whether blocks can be computed in-process, either
+// as the only engine in standalone mode or as a fallback for backends.
+func localCompute() bool {
+	return C.Standalone || C.LocalFallback
+}
+
+// computeMode describes where blocks are computed.
+func computeMode() string {
+	switch {
+	case C.Standalone:
+		return "standalone"
+	case C.LocalFallback:
+		return "backends+local"
+	}
+	return "backends"
+}
+
+// renderAvailable reports whether renders can be served at all.
+func renderAvailable() bool {
+	return cacheOnline() || backendOnline() || localCompute()
+}
+
+// renderReady checks, with the state found by the last connections and
+// health checks, that renders can be served. When they cannot at all it
+// replies 503 and returns false.
+func renderReady(w http.ResponseWriter) bool {
+	if renderAvailable() {
+		return true
+	}
+	log.Printf("No cache, backend or local compute available")
+	http.Error(w, "no cache, backend or local compute available", http.StatusServiceUnavailable)
+	return false
+}
+
+// localWorkers returns the number of blocks computed in-process at once.
+func localWorkers() int {
+	if C.LocalWorkers > 0 {
+		return C.LocalWorkers
+	}
+	return runtime.NumCPU()
+}
+
+// computeLocal computes a batch of blocks in-process with the kernel the
+// backend uses, copies them into the frame and caches them. It stops once
+// ctx is done, and otherwise returns the blocks it failed to compute with
+// the first error.
+func computeLocal(ctx context.Context, req *pb.BlockRequest, batch []blockPos, fr *frame, key string, cacheLim limiter, localLim limiter) ([]blockPos, error) {
+	var (
+		wg       sync.WaitGroup
+		errMux   sync.Mutex
+		failed   []blockPos
+		firstErr error
+	)
+	for _, bp := range batch {
+		if localLim.acquire(ctx) != nil {
+			break
+		}
+		wg.Add(1)
+		go func(bp blockPos) {
+			defer wg.Done()
+			defer localLim.release()
+
+			in := *req
+			in.XBlock, in.YBlock = int32(bp.x), int32(bp.y)
+			r, err := compute.Block(ctx, &in)
+			var b block
+			if err == nil {
+				w, h := fr.blockDims(bp.x, bp.y)
+				b, err = replyBlock(r, req.Smooth, w, h)
+			}
+			if err != nil {
+				errMux.Lock()
+				failed = append(failed, bp)
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMux.Unlock()
+				return
+			}
+			fr.addBlock(bp, b, false)
+
+			if cacheLim.acquire(ctx) != nil {
+				return
+			}
+			defer cacheLim.release()
+			setCachedBlock(key, bp.x, bp.y, b)
+		}(bp)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return failed, firstErr
+}
+
+// fallback computes blocks no backend could compute in-process, when the
+// local fallback is enabled, and fails them otherwise. Only the blocks that
+// could not be computed in-process either are failed.
+func (rs *renderState) fallback(req *pb.BlockRequest, batch []blockPos, fr *frame, cacheLim limiter) {
+	if !localCompute() {
+		rs.fail(batch)
+		return
+	}
+	if !C.Standalone {
+		log.Printf("Computing blocks locally: key=%s blocks=%d", rs.key, len(batch))
+	}
+	failed, err := computeLocal(rs.ctx, req, batch, fr, rs.key, cacheLim, currentLocalLimiter())
+	if rs.ctx.Err() != nil {
+		return
+	}
+	if status.Code(err) == codes.InvalidArgument {
+		rs.abort(err)
+	} else if err != nil {
+		log.Printf("Local compute failed: key=%s blocks=%d error=%s", rs.key, len(failed), err)
+		rs.fail(failed)
+	}
+}
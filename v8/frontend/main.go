@@ -2,261 +2,1056 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha1"
 	"encoding/json"
 	"fmt"
 	"image"
-	"image/color"
 	"image/png"
+	"io"
 	"log"
+	"math"
+	"math/big"
 	"net/http"
 	_ "net/http/pprof"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/hasiotis/mandelbrot/v8/mandel"
+	"github.com/hasiotis/mandelbrot/v8/packed"
 	pb "github.com/hasiotis/mandelbrot/v8/rpc"
-	"github.com/mediocregopher/radix.v2/pool"
 	"github.com/spf13/viper"
 	"golang.org/x/net/context"
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-type blockResult struct {
-	blockX    int
-	blockY    int
-	Rectangle [blockSize][blockSize]uint8
+// block holds the iteration counts of a block and, for smooth renders,
+// the fractional iteration counts. Blocks on the right and bottom edges of
+// a frame only use the first width columns and height rows, full blocks
+// leave them 0.
+type block struct {
+	Rectangle [blockSize][blockSize]uint32
+	Smooth    *[blockSize][blockSize]float32 `json:",omitempty"`
+	width     int
+	height    int
 }
 
+// size returns the number of columns and rows the block uses.
+func (b block) size() (int, int) {
+	if b.width == 0 && b.height == 0 {
+		return blockSize, blockSize
+	}
+	return b.width, b.height
+}
+
+// frame holds the iteration count of every pixel of a render, row by row.
+// smooth is only set for smooth renders, failed lists the blocks that could
+// not be computed. observe, when set, is told about every block filled in.
+type frame struct {
+	width    int
+	height   int
+	maxIters int
+	iters    []uint32
+	smooth   []float32
+	failed   []blockPos
+	observe  blockObserver
+}
+
+// blockObserver is called with every block of a frame as it is filled in,
+// cached telling whether it was found in the cache. It is called from many
+// goroutines at once.
+type blockObserver func(bp blockPos, b block, cached bool)
+
 const (
 	pStart    complex128 = (-2.0 - 1.5i)
 	pEnd      complex128 = (+0.6 + 1.5i)
 	blockSize int        = 32
+	maxPoints int        = 8192
+	iterLimit int        = 65536
+
+	// maxEscapeRadius bounds the escape radius, so its square stays far
+	// from overflowing.
+	maxEscapeRadius float64 = 1e100
 )
 
+const (
+	// cacheSchema is bumped whenever the layout of the cache keys or the
+	// cached blocks changes, so old entries are never read back.
+	cacheSchema int = 3
+)
+
+// The default view of the Julia sets.
+const (
+	juliaStart complex128 = (-1.6 - 1.6i)
+	juliaEnd   complex128 = (+1.6 + 1.6i)
+)
+
+// maxDeepDigits limits the length of the decimal coordinates of deep zooms.
+const maxDeepDigits int = 1200
+
+// deepViewport is a region given as decimal strings, for zooms past the
+// precision of float64.
+type deepViewport struct {
+	cx   string
+	cy   string
+	span string
+}
+
+// renderRequest describes the region of the complex plane to render and
+// the image it is rendered into. For Julia sets c is the constant of the
+// iteration. Deep zooms carry their region in deep, pStart and pEnd then
+// only approximate it.
+type renderRequest struct {
+	kind         pb.FractalKind
+	c            complex128
+	pStart       complex128
+	pEnd         complex128
+	width        int
+	height       int
+	maxIters     int
+	smooth       bool
+	formula      string
+	params       map[string]float64
+	escapeRadius float64
+	deep         *deepViewport
+	algorithm    pb.Algorithm
+}
+
 type config struct {
 	Points        int
 	MaxIters      int
 	RedisServer   string
 	BackendServer string
+	// Backends, BackendDNS (host:port resolved to A records), BackendSRV
+	// (resolved to SRV records) and BackendFile (a file with a Backends
+	// list, reread when it changes) add backends to balance renders over.
+	// BackendServer is only used when none of them is set.
+	Backends    []string
+	BackendDNS  string
+	BackendSRV  string
+	BackendFile string
+	Smooth      bool
+	// EscapeRadius is the default bailout radius, larger radii give
+	// smoother colouring.
+	EscapeRadius  float64
+	Palette       string
+	PaletteOffset float64
+	PaletteScale  float64
+	// PaletteDir holds extra palettes, JSON files and GIMP gradients.
+	// CyclicPalettes names the gradients that wrap around, which GIMP
+	// gradient files cannot tell.
+	PaletteDir     string
+	CyclicPalettes []string
+	// PackedResults asks the backend for packed results compressed with
+	// WireCompression (none, deflate or zstd) instead of repeated int32.
+	PackedResults   bool
+	WireCompression string
+	// Cache lists the cache levels (memory, redis, disk) in the order
+	// they are looked up. CacheMemoryBytes bounds the memory level and
+	// CacheDiskBytes the disk level, held in CacheDir, unbounded when 0.
+	// CacheTTL expires the blocks of a render in redis after they were
+	// last stored, never when 0.
+	Cache            []string
+	CacheMemoryBytes int64
+	CacheDir         string
+	CacheDiskBytes   int64
+	CacheTTL         time.Duration
+	// CacheCompression compresses the cached blocks. CacheOptional keeps
+	// the frontend ready while a cache level is unreachable.
+	CacheCompression string
+	CacheOptional    bool
+	// BlockOrder is the order blocks are rendered in: rowmajor, spiral
+	// (from the center) or hilbert. MaxInflight bounds the ComputeFrame
+	// streams open to a backend, each computing up to BlocksPerRPC blocks,
+	// and CacheConcurrency the concurrent cache lookups and stores.
+	BlockOrder       string
+	MaxInflight      int
+	BlocksPerRPC     int
+	CacheConcurrency int
+	// RetryAttempts is the number of times blocks that failed are retried,
+	// after RetryBackoff doubling on every attempt. ErrorBudget is the
+	// fraction of the blocks of a render that may fail before the render
+	// fails as a whole, instead of being sent with the blocks missing.
+	RetryAttempts int
+	RetryBackoff  time.Duration
+	ErrorBudget   float64
+	// RenderTimeout bounds the time a render may take, unbounded when 0.
+	// Renders are always canceled when the client goes away.
+	RenderTimeout time.Duration
+	// Standalone computes every block in-process and never dials a
+	// backend. LocalFallback, off by default, also computes the blocks no
+	// backend could compute in-process instead of failing them.
+	// LocalWorkers bounds the blocks computed in-process at once, all CPUs
+	// when 0.
+	Standalone    bool
+	LocalFallback bool
+	LocalWorkers  int
+	// JobStore keeps the state and results of render jobs, in memory or
+	// in redis, shared by the replicas, for JobTTL after their last
+	// update. MaxJobs bounds the jobs a replica renders at once and
+	// MaxQueuedJobs the jobs it holds queued or running; more are refused.
+	// JobStoreBytes bounds the results kept by the memory store.
+	JobStore      string
+	JobTTL        time.Duration
+	MaxJobs       int
+	MaxQueuedJobs int
+	JobStoreBytes int64
+	// Explorer serves the explorer to browsers asking for /, which get the
+	// default render otherwise. It is always served at /explore.
+	Explorer bool
+	// DrainTimeout is the time the frontend reports itself unready before
+	// shutting down, and then waits for the requests in flight.
+	DrainTimeout time.Duration
 }
 
 var (
 	Version string
 	Build   string
 	Date    string
-	mux     sync.Mutex
 	C       config
-	p       *pool.Pool
-	b       *grpc.ClientConn
-	c       pb.MandelServiceClient
-	h       pb.HealthClient
-	pOnline bool = false
-	bOnline bool = false
+
+	wireCompression  pb.Compression
+	cacheCompression pb.Compression
 )
 
-func getCachedBlock(i int, j int) ([blockSize][blockSize]uint8, bool) {
-	var cached bool = false
-	var unserialized [blockSize][blockSize]uint8
-	blockid := fmt.Sprintf("%03d%03d", i, j)
-	if pOnline {
-		mux.Lock()
-		exists, err := p.Cmd("HEXISTS", "mandel", blockid).Int()
+// cacheKey returns the key under which the blocks of a render are cached.
+// It is derived from every parameter that affects the computed blocks, so
+// renders with different parameters never share cached blocks.
+func cacheKey(rr renderRequest) string {
+	params := fmt.Sprintf("kind=%s c=%x,%x kernel=%d start=%x,%x end=%x,%x width=%d height=%d maxIters=%d blockSize=%d smooth=%t formula=%s escapeRadius=%x",
+		rr.kind, math.Float64bits(real(rr.c)), math.Float64bits(imag(rr.c)), mandel.KernelVersion,
+		math.Float64bits(real(rr.pStart)), math.Float64bits(imag(rr.pStart)),
+		math.Float64bits(real(rr.pEnd)), math.Float64bits(imag(rr.pEnd)),
+		rr.width, rr.height, rr.maxIters, blockSize, rr.smooth, rr.formula, math.Float64bits(rr.escapeRadius))
+	names := make([]string, 0, len(rr.params))
+	for name := range rr.params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		params += fmt.Sprintf(" %s=%x", name, math.Float64bits(rr.params[name]))
+	}
+	if rr.deep != nil {
+		params += fmt.Sprintf(" deep=%s,%s,%s algorithm=%s", rr.deep.cx, rr.deep.cy, rr.deep.span, rr.algorithm)
+	}
+	return fmt.Sprintf("mandel:v%d:%x", cacheSchema, sha1.Sum([]byte(params)))
+}
+
+func (d *deepViewport) toProto() *pb.DeepViewport {
+	if d == nil {
+		return nil
+	}
+	return &pb.DeepViewport{CenterX: d.cx, CenterY: d.cy, Span: d.span}
+}
+
+// clamp limits iteration counts to maxIters, the count of points that
+// never escaped.
+func (fr *frame) clamp(iters uint32) uint32 {
+	if iters > uint32(fr.maxIters) {
+		return uint32(fr.maxIters)
+	}
+	return iters
+}
+
+func getCachedBlock(key string, i int, j int) (block, bool) {
+	blockid := fmt.Sprintf("%d:%d", i, j)
+	v, cached, err := currentCache().Get(key, blockid)
+	if err != nil || !cached {
+		return block{}, false
+	}
+	unserialized, err := decodeBlock(v)
+	if err != nil {
+		log.Printf("Failed cache decode: key=%s blockid=%s error=%s", key, blockid, err)
+		return block{}, false
+	}
+	return unserialized, true
+}
+
+func setCachedBlock(key string, i int, j int, r block) {
+	blockid := fmt.Sprintf("%d:%d", i, j)
+	serialized, err := encodeBlock(r, cacheCompression)
+	if err != nil {
+		log.Printf("Serialize failed [%s]: key=%s blockid=%s\n", err, key, blockid)
+		return
+	}
+	currentCache().Set(key, blockid, serialized)
+}
+
+func defaultRenderRequest() renderRequest {
+	return renderRequest{
+		pStart:       pStart,
+		pEnd:         pEnd,
+		width:        C.Points,
+		height:       C.Points,
+		maxIters:     C.MaxIters,
+		smooth:       C.Smooth,
+		escapeRadius: C.EscapeRadius,
+	}
+}
+
+func intParam(q url.Values, name string, def int, min int, max int) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("%s out of range [%d, %d]: %d", name, min, max, n)
+	}
+	return n, nil
+}
+
+func boolParam(q url.Values, name string, def bool) (bool, error) {
+	v := q.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return b, nil
+}
+
+// complexParam parses a complex number given as "real,imag".
+func complexParam(q url.Values, name string, def complex128) (complex128, error) {
+	v := q.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	parts := strings.Split(v, ",")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	var f [2]float64
+	for n, part := range parts {
+		var err error
+		f[n], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(f[n]) || math.IsInf(f[n], 0) {
+			return 0, fmt.Errorf("invalid %s: %q", name, v)
+		}
+	}
+	return complex(f[0], f[1]), nil
+}
+
+func floatParam(q url.Values, name string, def float64) (float64, error) {
+	v := q.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return f, nil
+}
+
+// parseFractalParams reads the query parameters maxIters, smooth,
+// escapeRadius, formula and the formula parameters, given as
+// param.<name>=<value>.
+func parseFractalParams(q url.Values, rr *renderRequest) error {
+	var err error
+	if rr.maxIters, err = intParam(q, "maxIters", rr.maxIters, 1, iterLimit); err != nil {
+		return err
+	}
+	if rr.smooth, err = boolParam(q, "smooth", rr.smooth); err != nil {
+		return err
+	}
+	if rr.escapeRadius, err = floatParam(q, "escapeRadius", rr.escapeRadius); err != nil {
+		return err
+	}
+	if rr.escapeRadius < mandel.DefaultEscapeRadius || rr.escapeRadius > maxEscapeRadius {
+		return fmt.Errorf("escapeRadius out of range [%g, %g]: %g", mandel.DefaultEscapeRadius, maxEscapeRadius, rr.escapeRadius)
+	}
+	if formula := q.Get("formula"); formula != "" {
+		rr.formula = formula
+	}
+	for name := range q {
+		if !strings.HasPrefix(name, "param.") {
+			continue
+		}
+		v, err := floatParam(q, name, 0)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		if exists == 1 {
-			v, err := p.Cmd("HGET", "mandel", blockid).Bytes()
-			if err != nil {
-				log.Fatal(err)
-			} else {
-				err := json.Unmarshal(v, &unserialized)
-				if err != nil {
-					log.Printf("Failed cache unmarshal: error=%s", err)
-				} else {
-					cached = true
-				}
-			}
+		if rr.params == nil {
+			rr.params = make(map[string]float64)
 		}
-		mux.Unlock()
+		rr.params[strings.TrimPrefix(name, "param.")] = v
 	}
-	return unserialized, cached
+	return nil
 }
 
-func setCachedBlock(i int, j int, r [blockSize][blockSize]uint8) {
-	blockid := fmt.Sprintf("%03d%03d", i, j)
-	if pOnline {
-		serialized, err := json.Marshal(r)
-		if err != nil {
-			log.Printf("Serialize failed [%s]: blockid=%s\n", err, blockid)
+// decimalParam returns the decimal string of parameter name, or def
+// formatted as decimal when it is not given.
+func decimalParam(q url.Values, name string, def float64) (string, error) {
+	v := strings.TrimSpace(q.Get(name))
+	if v == "" {
+		return strconv.FormatFloat(def, 'g', -1, 64), nil
+	}
+	if len(v) > maxDeepDigits {
+		return "", fmt.Errorf("%s longer than %d digits", name, maxDeepDigits)
+	}
+	if _, _, err := big.ParseFloat(v, 10, 64, big.ToNearestEven); err != nil {
+		return "", fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return v, nil
+}
+
+// algorithmParam parses the algorithm used for deep zooms.
+func algorithmParam(q url.Values, name string, def pb.Algorithm) (pb.Algorithm, error) {
+	v := q.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	a, ok := pb.Algorithm_value[strings.ToUpper(v)]
+	if !ok {
+		return 0, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return pb.Algorithm(a), nil
+}
+
+// parseRenderRequest builds a renderRequest from the query parameters
+// cx, cy (center), span or zoom, width, height and the fractal parameters.
+// Parameters that are not given fall back to the ones of def, whose region
+// is fitted to the aspect ratio of the image. Regions given by their span
+// have square pixels, their height follows the aspect ratio. Regions too
+// small for float64, or requested with deep=true or a deep algorithm, are
+// rendered as deep zooms with the center kept as given.
+func parseRenderRequest(q url.Values, def renderRequest) (renderRequest, error) {
+	var err error
+	rr := def
+
+	if rr.width, err = intParam(q, "width", rr.width, 1, maxPoints); err != nil {
+		return rr, err
+	}
+	if rr.height, err = intParam(q, "height", rr.height, 1, maxPoints); err != nil {
+		return rr, err
+	}
+	if err = parseFractalParams(q, &rr); err != nil {
+		return rr, err
+	}
+	if rr.algorithm, err = algorithmParam(q, "algorithm", rr.algorithm); err != nil {
+		return rr, err
+	}
+	forceDeep := rr.algorithm == pb.Algorithm_BIGFLOAT || rr.algorithm == pb.Algorithm_PERTURBATION
+
+	if q.Get("cx") == "" && q.Get("cy") == "" && q.Get("span") == "" && q.Get("zoom") == "" && !forceDeep {
+		fitAspect(&rr, def)
+		return rr, nil
+	}
+	if q.Get("span") != "" && q.Get("zoom") != "" {
+		return rr, fmt.Errorf("span and zoom are mutually exclusive")
+	}
+
+	center := (def.pStart + def.pEnd) / 2
+	cx, err := floatParam(q, "cx", real(center))
+	if err != nil {
+		return rr, err
+	}
+	cy, err := floatParam(q, "cy", imag(center))
+	if err != nil {
+		return rr, err
+	}
+	span, err := floatParam(q, "span", real(def.pEnd-def.pStart))
+	if err != nil {
+		return rr, err
+	}
+	zoom, err := floatParam(q, "zoom", 1)
+	if err != nil {
+		return rr, err
+	}
+	if span <= 0 || zoom <= 0 {
+		return rr, fmt.Errorf("span and zoom must be positive")
+	}
+	span = span / zoom
+
+	half := complex(span/2, span/2*float64(rr.height)/float64(rr.width))
+	rr.pStart = complex(cx, cy) - half
+	rr.pEnd = complex(cx, cy) + half
+
+	// Below this pixel step neighbouring pixels collapse onto the same
+	// float64 value and the image turns into blocky garbage.
+	magnitude := math.Max(1, math.Max(math.Abs(cx), math.Abs(cy)))
+	deep, err := boolParam(q, "deep", forceDeep || span/float64(rr.width) < magnitude*1e-14)
+	if err != nil || !deep {
+		if err == nil && forceDeep {
+			err = fmt.Errorf("algorithm %s requires a deep zoom", strings.ToLower(rr.algorithm.String()))
 		}
-		mux.Lock()
+		return rr, err
+	}
 
-		_, err = p.Cmd("HSET", "mandel", blockid, serialized).Int()
-		if err != nil {
-			log.Fatal(err)
+	rr.deep = &deepViewport{span: strconv.FormatFloat(span, 'g', -1, 64)}
+	if rr.deep.cx, err = decimalParam(q, "cx", real(center)); err != nil {
+		return rr, err
+	}
+	if rr.deep.cy, err = decimalParam(q, "cy", imag(center)); err != nil {
+		return rr, err
+	}
+
+	return rr, nil
+}
+
+// blocks returns the number of columns and rows of blocks of the frame,
+// counting the partial blocks on its right and bottom edges.
+func (fr *frame) blocks() (int, int) {
+	return blockGrid(fr.width, fr.height)
+}
+
+// blockGrid returns the number of columns and rows of blocks of an image
+// of width x height pixels.
+func blockGrid(width int, height int) (int, int) {
+	return (width + blockSize - 1) / blockSize, (height + blockSize - 1) / blockSize
+}
+
+// blockDims returns the width and height of the block at (i, j), which
+// are cut to the frame on its right and bottom edges.
+func (fr *frame) blockDims(i int, j int) (int, int) {
+	w, h := blockSize, blockSize
+	if fr.width-i*blockSize < w {
+		w = fr.width - i*blockSize
+	}
+	if fr.height-j*blockSize < h {
+		h = fr.height - j*blockSize
+	}
+	return w, h
+}
+
+// fitAspect grows the region of def along one axis, so that on an image
+// of another aspect ratio than def it keeps the shape of its pixels and
+// still shows all of it. Images of the aspect ratio of def keep its region.
+func fitAspect(rr *renderRequest, def renderRequest) {
+	if rr.width*def.height == rr.height*def.width {
+		return
+	}
+	sx := float64(rr.width) / float64(def.width)
+	sy := float64(rr.height) / float64(def.height)
+	k := math.Max(1/sx, 1/sy)
+
+	center := (def.pStart + def.pEnd) / 2
+	grow := func(p complex128) complex128 {
+		d := p - center
+		return center + complex(real(d)*k*sx, imag(d)*k*sy)
+	}
+	rr.pStart, rr.pEnd = grow(def.pStart), grow(def.pEnd)
+}
+
+// setBlock copies the block at (i, j) into the frame, leaving out the
+// pixels past its edges.
+func (fr *frame) setBlock(i int, j int, b block) {
+	w, h := fr.blockDims(i, j)
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			n := (y+blockSize*j)*fr.width + x + blockSize*i
+			fr.iters[n] = b.Rectangle[x][y]
+			if fr.smooth != nil && b.Smooth != nil {
+				fr.smooth[n] = b.Smooth[x][y]
+			}
+		}
+	}
+}
+
+// addBlock copies the block at bp into the frame and tells the observer of
+// the frame about it.
+func (fr *frame) addBlock(bp blockPos, b block, cached bool) {
+	fr.setBlock(bp.x, bp.y, b)
+	if fr.observe != nil {
+		fr.observe(bp, b, cached)
+	}
+}
+
+// replyBlock converts a block of width x height pixels computed by the
+// backend, whichever encoding its results came in. Older backends always
+// send full blocks, whose pixels past the edges are dropped.
+func replyBlock(r *pb.BlockReply, smooth bool, width int, height int) (block, error) {
+	b := block{width: width, height: height}
+	results, err := packed.Unpack(r)
+	if err != nil {
+		return b, err
+	}
+	rows := height
+	if len(results) == blockSize*blockSize {
+		rows = blockSize
+	} else if len(results) != width*height {
+		return b, fmt.Errorf("block %d:%d has %d results, expected %d", r.XBlock, r.YBlock, len(results), width*height)
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			b.Rectangle[x][y] = uint32(results[x*rows+y])
+		}
+	}
+	if smooth && len(r.Smooth) == len(results) {
+		b.Smooth = new([blockSize][blockSize]float32)
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				b.Smooth[x][y] = r.Smooth[x*rows+y]
+			}
 		}
-		mux.Unlock()
 	}
+	return b, nil
 }
 
-func calculateMandel() *image.Gray {
-	img := image.NewGray(image.Rect(0, 0, C.Points, C.Points))
+// frameRequest returns the parameters shared by the blocks of a render.
+func frameRequest(rr renderRequest) *pb.BlockRequest {
+	encoding := pb.Encoding_REPEATED
+	if C.PackedResults {
+		encoding = pb.Encoding_PACKED
+	}
+	return &pb.BlockRequest{
+		PStart:        &pb.ComplexPoint{X: real(rr.pStart), Y: imag(rr.pStart)},
+		PEnd:          &pb.ComplexPoint{X: real(rr.pEnd), Y: imag(rr.pEnd)},
+		Points:        int32(rr.width),
+		Width:         int32(rr.width),
+		Height:        int32(rr.height),
+		MaxIters:      int32(rr.maxIters),
+		BlockSize:     int32(blockSize),
+		Smooth:        rr.smooth,
+		Kind:          rr.kind,
+		C:             &pb.ComplexPoint{X: real(rr.c), Y: imag(rr.c)},
+		Formula:       rr.formula,
+		FormulaParams: rr.params,
+		Deep:          rr.deep.toProto(),
+		Algorithm:     rr.algorithm,
+		EscapeRadius:  rr.escapeRadius,
+		Encoding:      encoding,
+		Compression:   wireCompression,
+	}
+}
+
+// calculateMandel renders a request. Blocks are visited in the configured
+// order. The ones found in the cache are used as they are, the rest are
+// computed by the backends in ComputeFrame streams of BlocksPerRPC blocks,
+// each sent to the online backend with the least streams open, and at most
+// MaxInflight streams open to a backend. Blocks that fail are retried with
+// backoff and, when they keep failing, computed in-process if the local
+// fallback is enabled or listed in the failed blocks of the frame. In
+// standalone mode every block is computed in-process. Requests the backend
+// rejects as invalid, and renders with more failed blocks than the error
+// budget allows, are returned as an error. Once ctx is done, the streams
+// and cache writes of the render are canceled and the error of ctx is
+// returned. observe, which may be nil, is told about every block as it is
+// found or computed.
+func calculateMandel(ctx context.Context, rr renderRequest, observe blockObserver) (*frame, error) {
+	fr := &frame{
+		width:    rr.width,
+		height:   rr.height,
+		maxIters: rr.maxIters,
+		iters:    make([]uint32, rr.width*rr.height),
+		observe:  observe,
+	}
+	if rr.smooth {
+		fr.smooth = make([]float32, rr.width*rr.height)
+	}
 
-	results := make(chan blockResult)
-	var res blockResult
+	key := cacheKey(rr)
+	cacheLim := currentCacheLimiter()
+	cols, rows := fr.blocks()
+	order := blockOrder(C.BlockOrder, cols, rows)
 
-	for i := 0; i < int(C.Points/blockSize); i++ {
-		for j := 0; j < int(C.Points/blockSize); j++ {
-			go func(i int, j int) {
-				var cached bool = false
-				var ret blockResult
-				ret.blockX = i
-				ret.blockY = j
-				if pOnline {
-					ret.Rectangle, cached = getCachedBlock(i, j)
-				}
-				if !cached && bOnline {
-					ps := &pb.ComplexPoint{real(pStart), imag(pStart)}
-					pe := &pb.ComplexPoint{real(pEnd), imag(pEnd)}
-					r, err := c.ComputeMandel(
-						context.Background(),
-						&pb.BlockRequest{ps, pe, int32(C.Points), int32(C.MaxIters), int32(blockSize), int32(i), int32(j)})
-					if err != nil {
-						log.Fatalf("Could not request compute: %v", err)
-					}
-					for x := 0; x < blockSize; x++ {
-						for y := 0; y < blockSize; y++ {
-							ret.Rectangle[x][y] = uint8(r.Results[x*blockSize+y])
-						}
-					}
-					setCachedBlock(i, j, ret.Rectangle)
+	missing := order
+	if cacheOnline() {
+		found := make([]bool, len(order))
+		var wg sync.WaitGroup
+		for n, bp := range order {
+			if cacheLim.acquire(ctx) != nil {
+				break
+			}
+			wg.Add(1)
+			go func(n int, bp blockPos) {
+				defer wg.Done()
+				defer cacheLim.release()
+				if b, cached := getCachedBlock(key, bp.x, bp.y); cached {
+					fr.addBlock(bp, b, true)
+					found[n] = true
 				}
+			}(n, bp)
+		}
+		wg.Wait()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
-				results <- ret
-			}(i, j)
+		missing = nil
+		for n, bp := range order {
+			if !found[n] {
+				missing = append(missing, bp)
+			}
 		}
 	}
+	if len(missing) == 0 {
+		return fr, nil
+	}
 
-	for i := 0; i < int(C.Points/blockSize); i++ {
-		for j := 0; j < int(C.Points/blockSize); j++ {
-			res = <-results
-			for x, ycol := range res.Rectangle {
-				for y, r := range ycol {
-					img.Set(x+blockSize*res.blockX, y+blockSize*res.blockY, color.Gray{r})
-				}
+	req := frameRequest(rr)
+	batchSize := C.BlocksPerRPC
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	rs := &renderState{ctx: ctx, key: key, total: len(order), budget: errorBudget(len(order))}
+
+	var wg sync.WaitGroup
+	for start := 0; start < len(missing); start += batchSize {
+		end := start + batchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		batch := missing[start:end]
+		if rs.stopped() {
+			rs.fail(batch)
+			continue
+		}
+		var be *backend
+		if !C.Standalone {
+			if be = backends.acquire(ctx, C.MaxInflight); be == nil && ctx.Err() != nil {
+				break
+			}
+		}
+		if be == nil {
+			if !C.Standalone {
+				log.Printf("No backend server available: key=%s blocks=%d", key, len(batch))
 			}
+			wg.Add(1)
+			go func(batch []blockPos) {
+				defer wg.Done()
+				rs.fallback(req, batch, fr, cacheLim)
+			}(batch)
+			continue
 		}
+		wg.Add(1)
+		go func(be *backend, batch []blockPos) {
+			defer wg.Done()
+			rs.computeBatch(be, req, batch, fr, cacheLim)
+		}(be, batch)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if rs.err != nil {
+		return nil, rs.err
 	}
+	if len(rs.failed) > rs.budget {
+		return nil, &budgetError{failed: len(rs.failed), total: rs.total}
+	}
+	fr.failed = rs.failed
+	return fr, nil
+}
 
-	return img
+// computeBatch computes a batch of blocks on be, retrying the blocks that
+// were not delivered with backoff on whichever backend is picked next,
+// before falling back to computing them in-process.
+func (rs *renderState) computeBatch(be *backend, req *pb.BlockRequest, batch []blockPos, fr *frame, cacheLim limiter) {
+	remaining := batch
+	for attempt := 0; ; attempt++ {
+		var err error
+		remaining, err = computeBlocks(rs.ctx, be, req, remaining, fr, rs.key, cacheLim)
+		backends.release(be)
+		if err == nil || rs.ctx.Err() != nil {
+			return
+		}
+		if status.Code(err) == codes.InvalidArgument {
+			rs.abort(err)
+			return
+		}
+		if status.Code(err) == codes.Unavailable {
+			backends.markOffline(be, err)
+		}
+		if attempt >= C.RetryAttempts || rs.stopped() {
+			log.Printf("Giving up on blocks: key=%s blocks=%d attempts=%d error=%s", rs.key, len(remaining), attempt+1, err)
+			if !rs.stopped() {
+				rs.fallback(req, remaining, fr, cacheLim)
+			} else {
+				rs.fail(remaining)
+			}
+			return
+		}
+
+		log.Printf("Retrying blocks: key=%s blocks=%d attempt=%d error=%s", rs.key, len(remaining), attempt+1, err)
+		select {
+		case <-time.After(retryBackoff(attempt)):
+		case <-rs.ctx.Done():
+			return
+		}
+		if be = backends.acquire(rs.ctx, C.MaxInflight); be == nil {
+			if rs.ctx.Err() != nil {
+				return
+			}
+			log.Printf("No backend server available: key=%s blocks=%d", rs.key, len(remaining))
+			rs.fallback(req, remaining, fr, cacheLim)
+			return
+		}
+	}
 }
 
-func sendImage(w http.ResponseWriter, img *image.Gray) {
+// computeBlocks computes a batch of blocks in a single ComputeFrame stream,
+// copies them into the frame and caches them. It returns the blocks that
+// were not delivered. Blocks arriving once ctx is done are not cached.
+func computeBlocks(ctx context.Context, be *backend, req *pb.BlockRequest, batch []blockPos, fr *frame, key string, cacheLim limiter) ([]blockPos, error) {
+	blocks := make([]*pb.BlockIndex, len(batch))
+	pending := make(map[blockPos]bool, len(batch))
+	for n, bp := range batch {
+		blocks[n] = &pb.BlockIndex{XBlock: int32(bp.x), YBlock: int32(bp.y)}
+		pending[bp] = true
+	}
+	remaining := func() []blockPos {
+		var left []blockPos
+		for _, bp := range batch {
+			if pending[bp] {
+				left = append(left, bp)
+			}
+		}
+		return left
+	}
+
+	stream, err := be.client.ComputeFrame(ctx, &pb.FrameRequest{Frame: req, Blocks: blocks})
+	if err != nil {
+		return batch, err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		outdated bool
+	)
+	defer wg.Wait()
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			if left := remaining(); len(left) > 0 {
+				return left, fmt.Errorf("backend %s ended the stream with %d blocks missing", be.addr, len(left))
+			}
+			return nil, nil
+		}
+		if err != nil {
+			return remaining(), err
+		}
+		bp := blockPos{int(r.XBlock), int(r.YBlock)}
+		if !pending[bp] {
+			return remaining(), fmt.Errorf("backend %s sent unexpected block %d:%d", be.addr, bp.x, bp.y)
+		}
+		w, h := fr.blockDims(bp.x, bp.y)
+		b, err := replyBlock(r, req.Smooth, w, h)
+		if err != nil {
+			return remaining(), err
+		}
+		fr.addBlock(bp, b, false)
+		delete(pending, bp)
+
+		// Blocks of backends running another kernel are used but not
+		// cached, the key promises results of this one.
+		if r.KernelVersion != mandel.KernelVersion {
+			if !outdated {
+				log.Printf("Not caching blocks of another kernel: backend=%s kernel=%d want=%d", be.addr, r.KernelVersion, mandel.KernelVersion)
+				outdated = true
+			}
+			continue
+		}
+		if cacheLim.acquire(ctx) != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(bp blockPos, b block) {
+			defer wg.Done()
+			defer cacheLim.release()
+			if ctx.Err() == nil {
+				setCachedBlock(key, bp.x, bp.y, b)
+			}
+		}(bp, b)
+	}
+}
+
+func sendImage(w http.ResponseWriter, img image.Image, code int) {
 	buffer := new(bytes.Buffer)
 	if err := png.Encode(buffer, img); err != nil {
 		log.Println("unable to encode image.")
 	}
+	sendPNG(w, buffer.Bytes(), code)
+}
 
+// sendPNG sends an encoded PNG image.
+func sendPNG(w http.ResponseWriter, data []byte, code int) {
 	w.Header().Set("Content-Type", "image/png")
-	w.Header().Set("Content-Length", strconv.Itoa(len(buffer.Bytes())))
-	if _, err := w.Write(buffer.Bytes()); err != nil {
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(code)
+	if _, err := w.Write(data); err != nil {
 		log.Println("Unable to write image.")
 	}
 }
 
-func redisConnect(retry bool) {
-	var err error
-	if !pOnline {
-		p, err = pool.New("tcp", C.RedisServer, 10)
-		if err == nil {
-			pOnline = true
-			log.Printf("Redis server is online")
-		}
+// handler renders the default view, or serves the explorer to browsers
+// asking for / unless Explorer is off.
+func handler(w http.ResponseWriter, r *http.Request) {
+	if wantsExplorer(r) {
+		explorerHandler(w, r)
 		return
 	}
+	renderHandler(w, r, defaultRenderRequest())
+}
 
-	if retry {
-		p, err = pool.New("tcp", C.RedisServer, 10)
+// juliaHandler renders the Julia set of the constant given as c=real,imag.
+func juliaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("c") == "" {
+		http.Error(w, "missing julia constant c", http.StatusBadRequest)
+		return
+	}
+	c, err := complexParam(r.URL.Query(), "c", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	renderHandler(w, r, juliaRenderRequest(c))
+}
+
+// queryRenderRequest parses a render request and its colors from the
+// parameters of /render, or with c from those of /julia.
+func queryRenderRequest(q url.Values) (renderRequest, colorOptions, error) {
+	def := defaultRenderRequest()
+	if q.Get("c") != "" {
+		c, err := complexParam(q, "c", 0)
 		if err != nil {
-			pOnline = false
-			log.Printf("Redis server is not reachable (retry): error=%s\n", err)
-		} else {
-			log.Printf("Redis server is online (retry)")
-		}
-	} else {
-		mux.Lock()
-		pong, err := p.Cmd("PING").Str()
-		if err != nil || pong != "PONG" {
-			pOnline = false
-			log.Printf("Redis server is not reachable: error=%s\n", err)
+			return renderRequest{}, colorOptions{}, err
 		}
-		mux.Unlock()
+		def = juliaRenderRequest(c)
 	}
+	rr, err := parseRenderRequest(q, def)
+	if err != nil {
+		return rr, colorOptions{}, err
+	}
+	co, err := parseColorOptions(q)
+	return rr, co, err
 }
 
-func backendConnect(retry bool) {
-	var err error
-	if !bOnline {
-		b, err = grpc.Dial(C.BackendServer, grpc.WithInsecure())
-		if err == nil {
-			c = pb.NewMandelServiceClient(b)
-			h = pb.NewHealthClient(b)
-			r, err := h.Check(context.Background(), &pb.HealthCheckRequest{"Check"})
-			if err == nil && r.GetStatus().String() == "SERVING" {
-				bOnline = true
-				log.Printf("Backend server is online")
-			}
-		}
+// juliaRenderRequest returns the default request of the Julia set of the
+// constant c.
+func juliaRenderRequest(c complex128) renderRequest {
+	rr := defaultRenderRequest()
+	rr.kind = pb.FractalKind_JULIA
+	rr.c = c
+	rr.pStart = juliaStart
+	rr.pEnd = juliaEnd
+	return rr
+}
+
+func renderHandler(w http.ResponseWriter, r *http.Request, def renderRequest) {
+	rr, err := parseRenderRequest(r.URL.Query(), def)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	co, err := parseColorOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if retry {
-		log.Printf("  This is a retry")
-		b, err = grpc.Dial(C.BackendServer, grpc.WithInsecure())
-		if err != nil {
-			bOnline = false
-			log.Printf("Backend server is not reachable (retry): error=%s\n", err)
-		} else {
-			log.Printf("Backend server is online (retry)")
-		}
-	} else {
-		h := pb.NewHealthClient(b)
-		r, err := h.Check(context.Background(), &pb.HealthCheckRequest{"Check"})
-		if err != nil || r.GetStatus().String() != "SERVING" {
-			bOnline = false
-			log.Printf("Backend server is not reachable: status=%s\n", r.GetStatus())
-		}
+	if !renderReady(w) {
+		return
+	}
 
+	ctx, cancel := renderContext(r)
+	defer cancel()
+	fr, err := calculateMandel(ctx, rr, nil)
+	if err != nil {
+		writeRenderError(w, err)
+		return
 	}
+	sendFrame(w, fr, co)
 }
 
-func handler(w http.ResponseWriter, r *http.Request) {
-	redisConnect(false)
-	backendConnect(false)
-
-	if pOnline || bOnline {
-		img := calculateMandel()
-		sendImage(w, img)
-	} else {
-		log.Printf("Both redis and backend servers are not available!\n")
+// renderContext returns the context of the render of a request, which is
+// canceled when the client goes away or after RenderTimeout.
+func renderContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if C.RenderTimeout > 0 {
+		return context.WithTimeout(r.Context(), C.RenderTimeout)
 	}
+	return context.WithCancel(r.Context())
 }
 
-func readConfig() {
+// readConfig loads the configuration into C. A configuration that cannot
+// be read or decoded on reload leaves C as it was, the error being reported
+// by /ready, and false is returned.
+func readConfig(reload bool) bool {
+	var fileErr error
 	err := viper.ReadInConfig()
-	if err != nil {
+	if _, notFound := err.(viper.ConfigFileNotFoundError); err != nil && !notFound {
+		if reload {
+			log.Printf("Unable to read the configuration file - keeping the current configuration: error=%s", err)
+			setConfigError(err)
+			return false
+		}
+		log.Printf("Unable to read the configuration file - using defaults: error=%s", err)
+		fileErr = err
+	} else if err != nil {
 		log.Printf("No configuration file loaded - using defaults")
 	} else {
 		log.Printf("Reading configuration from config file: configfile=config.yml")
 	}
 
-	err = viper.Unmarshal(&C)
+	var next config
+	if err := viper.Unmarshal(&next); err != nil {
+		if !reload {
+			log.Fatalf("Unable to decode into struct, %v", err)
+		}
+		log.Printf("Unable to decode the configuration - keeping the current configuration: error=%s", err)
+		setConfigError(err)
+		return false
+	}
+	C = next
+
+	log.Printf("Configuration: Points=%d MaxIters=%d BackendServer=%s RedisServer=%s Palette=%s Compute=%s", C.Points, C.MaxIters, C.BackendServer, C.RedisServer, C.Palette, computeMode())
+
+	if C.EscapeRadius < mandel.DefaultEscapeRadius || C.EscapeRadius > maxEscapeRadius {
+		log.Printf("Invalid escape radius, using the default: EscapeRadius=%g", C.EscapeRadius)
+		C.EscapeRadius = mandel.DefaultEscapeRadius
+	}
+	wireCompression = compressionConfig("WireCompression", C.WireCompression)
+	cacheCompression = compressionConfig("CacheCompression", C.CacheCompression)
+	if C.JobTTL < time.Second {
+		log.Printf("Invalid job TTL, using the default: JobTTL=%s", C.JobTTL)
+		C.JobTTL = defaultJobTTL
+	}
+	if C.MaxQueuedJobs < C.MaxJobs {
+		log.Printf("MaxQueuedJobs below MaxJobs, using MaxJobs: MaxQueuedJobs=%d MaxJobs=%d", C.MaxQueuedJobs, C.MaxJobs)
+		C.MaxQueuedJobs = C.MaxJobs
+	}
+	if C.JobStoreBytes <= 0 {
+		log.Printf("Invalid job store size, using the default: JobStoreBytes=%d", C.JobStoreBytes)
+		C.JobStoreBytes = defaultJobStoreBytes
+	}
+	setupCache()
+	setupJobStore()
+	setupLimiters()
+	watchBackendFile(C.BackendFile)
+
+	loadPalettes(C.PaletteDir, C.CyclicPalettes)
+
+	err = validateConfig(fileErr)
 	if err != nil {
-		log.Fatalf("Unable to decode into struct, %v", err)
+		log.Printf("Invalid configuration: %s", err)
 	}
+	setConfigError(err)
+	return true
+}
 
-	log.Printf("Configuration: Points=%d MaxIters=%d BackendServer=%s RedisServer=%s", C.Points, C.MaxIters, C.BackendServer, C.RedisServer)
+// compressionConfig parses the compression of a configuration setting,
+// falling back to no compression.
+func compressionConfig(name string, v string) pb.Compression {
+	c, ok := pb.Compression_value[strings.ToUpper(v)]
+	if !ok {
+		log.Printf("Unknown compression, not compressing: %s=%s", name, v)
+	}
+	return pb.Compression(c)
 }
 
 func viewVersion(w http.ResponseWriter, r *http.Request) {
@@ -276,7 +1071,7 @@ func viewHealthz(w http.ResponseWriter, r *http.Request) {
 
 	statusCode := http.StatusOK
 	healthzOut["status"] = "OK"
-	if !bOnline && !pOnline {
+	if !renderAvailable() {
 		statusCode = http.StatusConflict
 		healthzOut["status"] = "FAILED"
 	}
@@ -290,14 +1085,17 @@ func viewHealthz(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-func viewReady(w http.ResponseWriter, r *http.Request) {
-}
-
 func viewStatus(w http.ResponseWriter, r *http.Request) {
 	statusOut := make(map[string]string)
 
-	statusOut["redisConnection"] = strconv.FormatBool(pOnline)
-	statusOut["backendConnection"] = strconv.FormatBool(bOnline)
+	statusOut["cache"] = currentCache().Name()
+	statusOut["cacheConnection"] = strconv.FormatBool(cacheOnline())
+	online, total := backends.online()
+	statusOut["backendConnection"] = strconv.FormatBool(online > 0)
+	statusOut["backends"] = fmt.Sprintf("%d/%d", online, total)
+	statusOut["compute"] = computeMode()
+	statusOut["jobStore"] = currentJobStore().Name()
+	statusOut["jobStoreConnection"] = strconv.FormatBool(currentJobStore().Online())
 
 	json.NewEncoder(w).Encode(statusOut)
 }
@@ -316,18 +1114,58 @@ func getConfig() {
 	viper.SetDefault("MaxIters", 256)
 	viper.SetDefault("MaxIters", 256)
 
+	viper.SetDefault("Smooth", false)
+	viper.SetDefault("EscapeRadius", mandel.DefaultEscapeRadius)
+	viper.SetDefault("Palette", "gray")
+	viper.SetDefault("PaletteDir", "")
+	viper.SetDefault("CyclicPalettes", []string{})
+	viper.SetDefault("PaletteOffset", 0.0)
+	viper.SetDefault("PaletteScale", 1.0)
+
+	viper.SetDefault("PackedResults", true)
+	viper.SetDefault("WireCompression", "zstd")
+	viper.SetDefault("Cache", []string{"redis"})
+	viper.SetDefault("CacheMemoryBytes", 256<<20)
+	viper.SetDefault("CacheDir", filepath.Join(os.TempDir(), "mandelbrot-frontend"))
+	viper.SetDefault("CacheDiskBytes", 1<<30)
+	viper.SetDefault("CacheTTL", "24h")
+	viper.SetDefault("CacheCompression", "zstd")
+	viper.SetDefault("CacheOptional", false)
+
+	viper.SetDefault("BlockOrder", "spiral")
+	viper.SetDefault("MaxInflight", 4)
+	viper.SetDefault("BlocksPerRPC", 64)
+	viper.SetDefault("CacheConcurrency", 16)
+	viper.SetDefault("RetryAttempts", 3)
+	viper.SetDefault("RetryBackoff", "100ms")
+	viper.SetDefault("ErrorBudget", 0.1)
+	viper.SetDefault("RenderTimeout", "0s")
+	viper.SetDefault("Standalone", false)
+	viper.SetDefault("LocalFallback", false)
+	viper.SetDefault("LocalWorkers", 0)
+	viper.SetDefault("JobStore", "memory")
+	viper.SetDefault("JobTTL", defaultJobTTL)
+	viper.SetDefault("MaxJobs", 2)
+	viper.SetDefault("MaxQueuedJobs", 16)
+	viper.SetDefault("JobStoreBytes", defaultJobStoreBytes)
+	viper.SetDefault("Explorer", true)
+	viper.SetDefault("DrainTimeout", "10s")
+
 	viper.SetDefault("RedisServer", "localhost:6379")
 	viper.SetDefault("BackendServer", "localhost:28000")
 
 	viper.WatchConfig()
 	viper.OnConfigChange(func(e fsnotify.Event) {
 		log.Printf("Config file changed: filename=%s", e.Name)
-		readConfig()
-		redisConnect(true)
+		if !readConfig(true) {
+			return
+		}
+		cacheConnect(true)
+		jobStoreConnect(true)
 		backendConnect(true)
 	})
 
-	readConfig()
+	readConfig(false)
 }
 
 func main() {
@@ -336,21 +1174,41 @@ func main() {
 	getConfig()
 
 	http.HandleFunc("/", handler)
+	http.HandleFunc("/render", handler)
+	http.HandleFunc("/explore", explorerHandler)
+	http.HandleFunc("/palettes", viewPalettes)
+	http.HandleFunc("/julia", juliaHandler)
+	http.HandleFunc("/tiles/", tileHandler)
+	http.HandleFunc("/stream", streamHandler)
+	http.HandleFunc("/jobs", jobsHandler)
+	http.HandleFunc("/jobs/", jobHandler)
 	http.HandleFunc("/version", viewVersion)
 	http.HandleFunc("/config", viewConfig)
 	http.HandleFunc("/status", viewStatus)
 	http.HandleFunc("/healthz", viewHealthz)
 	http.HandleFunc("/ready", viewReady)
+
+	// Requests only read the state found by the connections and health
+	// checks run here, the first time before serving.
+	refreshConnections()
+	srv := &http.Server{Addr: ":8080"}
 	go func() {
-		if err := http.ListenAndServe(":8080", nil); err != nil {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Printf("Http server failed: msg=%s", err)
 		}
 	}()
+	go drainOnSignal(srv)
 
 	t := time.NewTicker(time.Second * 10)
-	for {
-		redisConnect(false)
-		backendConnect(false)
-		<-t.C
+	for range t.C {
+		refreshConnections()
 	}
 }
+
+// refreshConnections connects the cache, the job store and the backends,
+// and checks the health of what is connected.
+func refreshConnections() {
+	cacheConnect(false)
+	jobStoreConnect(false)
+	backendConnect(false)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"testing"
+
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+)
+
+func testRenderRequest() renderRequest {
+	return renderRequest{
+		pStart:       pStart,
+		pEnd:         pEnd,
+		width:        256,
+		height:       256,
+		maxIters:     100,
+		escapeRadius: 2,
+	}
+}
+
+func near(a complex128, b complex128) bool {
+	return math.Abs(real(a)-real(b)) < 1e-12 && math.Abs(imag(a)-imag(b)) < 1e-12
+}
+
+func TestParseRenderRequest(t *testing.T) {
+	def := testRenderRequest()
+	tests := []struct {
+		name   string
+		query  string
+		start  complex128
+		end    complex128
+		width  int
+		height int
+		deep   bool
+	}{
+		{"defaults", "", pStart, pEnd, 256, 256, false},
+		{"wide default", "width=512", -3.3 - 1.5i, 1.9 + 1.5i, 512, 256, false},
+		{"tall default", "height=512", -2 - 3i, 0.6 + 3i, 256, 512, false},
+		{"center and span", "cx=-0.5&cy=0.25&span=2", -1.5 - 0.75i, 0.5 + 1.25i, 256, 256, false},
+		{"span follows aspect", "cx=0&cy=0&span=4&width=400&height=100", -2 - 0.5i, 2 + 0.5i, 400, 100, false},
+		{"zoom divides span", "cx=0&cy=0&zoom=2.6", -0.5 - 0.5i, 0.5 + 0.5i, 256, 256, false},
+		{"deep below float64", "cx=-0.75&cy=0.1&span=1e-14", 0, 0, 256, 256, true},
+		{"deep requested", "cx=-0.75&cy=0.1&span=1e-3&deep=true", 0, 0, 256, 256, true},
+		{"deep algorithm", "algorithm=bigfloat", 0, 0, 256, 256, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			rr, err := parseRenderRequest(q, def)
+			if err != nil {
+				t.Fatalf("parseRenderRequest(%q): %s", tt.query, err)
+			}
+			if rr.width != tt.width || rr.height != tt.height {
+				t.Errorf("size = %dx%d, want %dx%d", rr.width, rr.height, tt.width, tt.height)
+			}
+			if (rr.deep != nil) != tt.deep {
+				t.Fatalf("deep = %v, want %v", rr.deep != nil, tt.deep)
+			}
+			if tt.deep {
+				return
+			}
+			if !near(rr.pStart, tt.start) || !near(rr.pEnd, tt.end) {
+				t.Errorf("region = %v..%v, want %v..%v", rr.pStart, rr.pEnd, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestParseRenderRequestDeepCenter(t *testing.T) {
+	cx := "-0.743643887037158704752191506114774"
+	q := url.Values{"cx": {cx}, "cy": {"0.131825904205311970493132056385139"}, "span": {"1e-20"}}
+	rr, err := parseRenderRequest(q, testRenderRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.deep == nil || rr.deep.cx != cx || rr.deep.span != "1e-20" {
+		t.Errorf("deep = %+v, want center kept as given", rr.deep)
+	}
+}
+
+func TestParseRenderRequestErrors(t *testing.T) {
+	for _, query := range []string{
+		"width=0",
+		"width=8193",
+		"height=abc",
+		"span=1&zoom=2",
+		"span=0",
+		"span=-1",
+		"zoom=0",
+		"cx=NaN",
+		"cy=Inf",
+		"maxIters=0",
+		"smooth=maybe",
+		"escapeRadius=1",
+		"param.a=x",
+		"algorithm=quantum",
+		"algorithm=perturbation&deep=false",
+	} {
+		q, _ := url.ParseQuery(query)
+		if _, err := parseRenderRequest(q, testRenderRequest()); err == nil {
+			t.Errorf("parseRenderRequest(%q) succeeded", query)
+		}
+	}
+}
+
+func TestParseRenderRequestFractalParams(t *testing.T) {
+	q, _ := url.ParseQuery("maxIters=500&smooth=true&formula=multibrot&param.power=3&escapeRadius=100")
+	rr, err := parseRenderRequest(q, testRenderRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.maxIters != 500 || !rr.smooth || rr.formula != "multibrot" || rr.params["power"] != 3 || rr.escapeRadius != 100 {
+		t.Errorf("got %+v", rr)
+	}
+	if rr.algorithm != pb.Algorithm_AUTO {
+		t.Errorf("algorithm = %s, want the default", rr.algorithm)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	base := testRenderRequest()
+	base.params = map[string]float64{"power": 3, "bailout": 4}
+	key := cacheKey(base)
+	if !strings.HasPrefix(key, fmt.Sprintf("mandel:v%d:", cacheSchema)) {
+		t.Errorf("cacheKey = %s, want the schema version in it", key)
+	}
+	same := base
+	same.params = map[string]float64{"bailout": 4, "power": 3}
+	if cacheKey(same) != key {
+		t.Errorf("cacheKey depends on the order of the formula parameters")
+	}
+
+	changes := map[string]func(rr *renderRequest){
+		"kind":         func(rr *renderRequest) { rr.kind = pb.FractalKind_JULIA },
+		"c":            func(rr *renderRequest) { rr.c = 0.1i },
+		"start":        func(rr *renderRequest) { rr.pStart += 1e-15 },
+		"end":          func(rr *renderRequest) { rr.pEnd -= 1e-15i },
+		"width":        func(rr *renderRequest) { rr.width++ },
+		"height":       func(rr *renderRequest) { rr.height++ },
+		"maxIters":     func(rr *renderRequest) { rr.maxIters++ },
+		"smooth":       func(rr *renderRequest) { rr.smooth = true },
+		"formula":      func(rr *renderRequest) { rr.formula = "multibrot" },
+		"param":        func(rr *renderRequest) { rr.params = map[string]float64{"power": 4, "bailout": 4} },
+		"extra param":  func(rr *renderRequest) { rr.params = map[string]float64{"power": 3, "bailout": 4, "x": 0} },
+		"escapeRadius": func(rr *renderRequest) { rr.escapeRadius = 4 },
+		"deep":         func(rr *renderRequest) { rr.deep = &deepViewport{cx: "-0.7", cy: "0", span: "1e-20"} },
+		"algorithm": func(rr *renderRequest) {
+			rr.deep = &deepViewport{cx: "-0.7", cy: "0", span: "1e-20"}
+			rr.algorithm = pb.Algorithm_BIGFLOAT
+		},
+	}
+	seen := map[string]string{key: "base"}
+	for name, change := range changes {
+		rr := base
+		rr.params = map[string]float64{"power": 3, "bailout": 4}
+		change(&rr)
+		k := cacheKey(rr)
+		if other, ok := seen[k]; ok {
+			t.Errorf("changing %s gives the key of %s", name, other)
+		}
+		seen[k] = name
+	}
+}
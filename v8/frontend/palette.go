@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Blending functions of a gradient segment, numbered as in GIMP .ggr files.
+const (
+	blendLinear = iota
+	blendCurved
+	blendSine
+	blendSphereIncreasing
+	blendSphereDecreasing
+	blendStep
+)
+
+// segment blends from c0 at left to c1 at right, with mid being the
+// position where the blend is half way.
+type segment struct {
+	left  float64
+	mid   float64
+	right float64
+	c0    [4]float64
+	c1    [4]float64
+	blend int
+}
+
+// palette is a gradient over [0, 1]. Cyclic palettes wrap around when the
+// colouring runs past either end, the others are clamped.
+type palette struct {
+	name     string
+	cyclic   bool
+	segments []segment
+}
+
+// colorOptions selects the palette of a render and how iteration counts
+// are mapped onto it.
+type colorOptions struct {
+	palette *palette
+	offset  float64
+	scale   float64
+}
+
+var (
+	paletteMux sync.RWMutex
+	palettes   = builtinPalettes()
+)
+
+func builtinPalettes() map[string]*palette {
+	p := make(map[string]*palette)
+	for _, b := range []struct {
+		name   string
+		cyclic bool
+		colors []string
+	}{
+		{"gray", false, []string{"#000000", "#ffffff"}},
+		{"fire", false, []string{"#000000", "#7f0000", "#ff4000", "#ffc000", "#ffffff"}},
+		{"ocean", false, []string{"#000010", "#003070", "#0090c0", "#80e0ff", "#ffffff"}},
+		{"classic", true, []string{"#000764", "#206bcb", "#edffff", "#ffaa00", "#000200", "#000764"}},
+		{"rainbow", true, []string{"#ff0000", "#ffff00", "#00ff00", "#00ffff", "#0000ff", "#ff00ff", "#ff0000"}},
+	} {
+		pal, err := newPalette(b.name, b.cyclic, b.colors)
+		if err != nil {
+			log.Fatalf("Invalid builtin palette: name=%s error=%s", b.name, err)
+		}
+		p[b.name] = pal
+	}
+	return p
+}
+
+func parseHexColor(s string) ([4]float64, error) {
+	var c [4]float64
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 && len(s) != 8 {
+		return c, fmt.Errorf("invalid color: %q", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return c, fmt.Errorf("invalid color: %q", s)
+	}
+	if len(s) == 6 {
+		v = v<<8 | 0xff
+	}
+	for n := 0; n < 4; n++ {
+		c[n] = float64((v>>uint(24-8*n))&0xff) / 255
+	}
+	return c, nil
+}
+
+// newPalette builds a palette that blends linearly between evenly spaced colors.
+func newPalette(name string, cyclic bool, colors []string) (*palette, error) {
+	if len(colors) < 2 {
+		return nil, fmt.Errorf("palette %s needs at least two colors", name)
+	}
+
+	pal := &palette{name: name, cyclic: cyclic}
+	step := 1 / float64(len(colors)-1)
+	prev, err := parseHexColor(colors[0])
+	if err != nil {
+		return nil, err
+	}
+	for n, s := range colors[1:] {
+		c, err := parseHexColor(s)
+		if err != nil {
+			return nil, err
+		}
+		left := float64(n) * step
+		pal.segments = append(pal.segments, segment{
+			left:  left,
+			mid:   left + step/2,
+			right: left + step,
+			c0:    prev,
+			c1:    c,
+			blend: blendLinear,
+		})
+		prev = c
+	}
+	return pal, nil
+}
+
+// readJSONPalette reads a palette file of the form
+// {"name": "sunset", "cyclic": true, "colors": ["#ff0000", "#ffff00"]}.
+func readJSONPalette(r io.Reader) (*palette, error) {
+	var def struct {
+		Name   string
+		Cyclic bool
+		Colors []string
+	}
+	if err := json.NewDecoder(r).Decode(&def); err != nil {
+		return nil, err
+	}
+	return newPalette(def.Name, def.Cyclic, def.Colors)
+}
+
+// readGGRPalette reads a GIMP gradient file. HSV segments are blended in RGB.
+// The format does not tell whether a gradient wraps around, cyclic does.
+func readGGRPalette(r io.Reader, cyclic bool) (*palette, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) < 3 || lines[0] != "GIMP Gradient" || !strings.HasPrefix(lines[1], "Name:") {
+		return nil, fmt.Errorf("not a GIMP gradient")
+	}
+
+	pal := &palette{name: strings.TrimSpace(strings.TrimPrefix(lines[1], "Name:")), cyclic: cyclic}
+	count, err := strconv.Atoi(lines[2])
+	if err != nil || count < 1 || len(lines) < 3+count {
+		return nil, fmt.Errorf("invalid gradient segment count: %q", lines[2])
+	}
+	for _, line := range lines[3 : 3+count] {
+		fields := strings.Fields(line)
+		if len(fields) < 13 {
+			return nil, fmt.Errorf("invalid gradient segment: %q", line)
+		}
+		var v [11]float64
+		for n := range v {
+			if v[n], err = strconv.ParseFloat(fields[n], 64); err != nil {
+				return nil, fmt.Errorf("invalid gradient segment: %q", line)
+			}
+		}
+		seg := segment{left: v[0], mid: v[1], right: v[2]}
+		copy(seg.c0[:], v[3:7])
+		copy(seg.c1[:], v[7:11])
+		if seg.blend, err = strconv.Atoi(fields[11]); err != nil || seg.blend < 0 || seg.blend > blendStep {
+			return nil, fmt.Errorf("invalid gradient blending: %q", line)
+		}
+		pal.segments = append(pal.segments, seg)
+	}
+	return pal, nil
+}
+
+// loadPalettes replaces the palettes with the builtins plus every .json
+// and .ggr file in dir. Palette files are named after their file name. The
+// gradients named in cyclic wrap around.
+func loadPalettes(dir string, cyclic []string) {
+	wraps := make(map[string]bool)
+	for _, name := range cyclic {
+		wraps[name] = true
+	}
+	p := builtinPalettes()
+	if dir != "" {
+		files, _ := filepath.Glob(filepath.Join(dir, "*"))
+		for _, file := range files {
+			ext := filepath.Ext(file)
+			if ext != ".json" && ext != ".ggr" {
+				continue
+			}
+			f, err := os.Open(file)
+			if err != nil {
+				log.Printf("Unable to open palette: file=%s error=%s", file, err)
+				continue
+			}
+			name := strings.TrimSuffix(filepath.Base(file), ext)
+			var pal *palette
+			if ext == ".json" {
+				pal, err = readJSONPalette(f)
+			} else {
+				pal, err = readGGRPalette(f, wraps[name])
+			}
+			f.Close()
+			if err != nil {
+				log.Printf("Unable to read palette: file=%s error=%s", file, err)
+				continue
+			}
+			pal.name = name
+			p[pal.name] = pal
+		}
+	}
+
+	paletteMux.Lock()
+	palettes = p
+	paletteMux.Unlock()
+	log.Printf("Loaded palettes: count=%d dir=%s", len(p), dir)
+}
+
+// paletteNames returns the names of the loaded palettes, sorted.
+func paletteNames() []string {
+	paletteMux.RLock()
+	defer paletteMux.RUnlock()
+	names := make([]string, 0, len(palettes))
+	for name := range palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func viewPalettes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(paletteNames())
+}
+
+func getPalette(name string) (*palette, bool) {
+	paletteMux.RLock()
+	defer paletteMux.RUnlock()
+	pal, ok := palettes[name]
+	return pal, ok
+}
+
+// factor returns how far the blend has progressed at pos, following the
+// GIMP gradient semantics.
+func (s *segment) factor(pos float64) float64 {
+	length := s.right - s.left
+	if length <= 0 {
+		return 0
+	}
+	pos = (pos - s.left) / length
+	mid := (s.mid - s.left) / length
+
+	var linear float64
+	switch {
+	case pos <= mid && mid > 0:
+		linear = 0.5 * pos / mid
+	case pos > mid && mid < 1:
+		linear = 0.5 + 0.5*(pos-mid)/(1-mid)
+	default:
+		linear = 0.5
+	}
+
+	switch s.blend {
+	case blendCurved:
+		if mid <= 0 || mid >= 1 {
+			return linear
+		}
+		return math.Pow(pos, math.Log(0.5)/math.Log(mid))
+	case blendSine:
+		return (math.Sin(-math.Pi/2+math.Pi*linear) + 1) / 2
+	case blendSphereIncreasing:
+		return math.Sqrt(1 - (linear-1)*(linear-1))
+	case blendSphereDecreasing:
+		return 1 - math.Sqrt(1-linear*linear)
+	case blendStep:
+		if pos >= mid {
+			return 1
+		}
+		return 0
+	}
+	return linear
+}
+
+// at returns the color of the palette at t. Cyclic palettes wrap t into
+// [0, 1), the others clamp it.
+func (p *palette) at(t float64) color.RGBA {
+	if p.cyclic {
+		t -= math.Floor(t)
+	} else {
+		t = math.Max(0, math.Min(1, t))
+	}
+
+	s := &p.segments[len(p.segments)-1]
+	for n := range p.segments {
+		if t <= p.segments[n].right {
+			s = &p.segments[n]
+			break
+		}
+	}
+
+	f := s.factor(t)
+	var c [4]uint8
+	for n := range c {
+		c[n] = uint8(math.Round(255 * (s.c0[n] + (s.c1[n]-s.c0[n])*f)))
+	}
+	return color.RGBA{c[0], c[1], c[2], c[3]}
+}
+
+func defaultColorOptions() colorOptions {
+	pal, ok := getPalette(C.Palette)
+	if !ok {
+		pal, _ = getPalette("gray")
+	}
+	return colorOptions{palette: pal, offset: C.PaletteOffset, scale: C.PaletteScale}
+}
+
+// parseColorOptions reads the palette, offset and scale query parameters.
+func parseColorOptions(q url.Values) (colorOptions, error) {
+	var err error
+	co := defaultColorOptions()
+
+	if name := q.Get("palette"); name != "" {
+		pal, ok := getPalette(name)
+		if !ok {
+			return co, fmt.Errorf("unknown palette: %q", name)
+		}
+		co.palette = pal
+	}
+	if co.offset, err = floatParam(q, "offset", co.offset); err != nil {
+		return co, err
+	}
+	if co.scale, err = floatParam(q, "scale", co.scale); err != nil {
+		return co, err
+	}
+	return co, nil
+}
+
+// colorize maps the iteration counts of a frame through the palette.
+// Points that never escaped are painted black. Frames with few enough
+// distinct iteration counts are returned as an image.Paletted.
+func colorize(fr *frame, co colorOptions) image.Image {
+	if fr.smooth != nil {
+		return colorizeSmooth(fr, co)
+	}
+	return colorizeLUT(fr, colorLUT(fr.maxIters, co))
+}
+
+// colorLUT returns the colours of the iteration counts 0 to maxIters, for
+// frames of maxIters iterations. Points that never escaped are black.
+func colorLUT(maxIters int, co colorOptions) color.Palette {
+	lut := make(color.Palette, maxIters+1)
+	for n := 0; n < maxIters; n++ {
+		lut[n] = co.palette.at(co.offset + co.scale*float64(n)/float64(maxIters))
+	}
+	lut[maxIters] = color.RGBA{0, 0, 0, 0xff}
+	return lut
+}
+
+// colorizeLUT maps the integer iteration counts of a frame through lut, the
+// colorLUT of its maxIters.
+func colorizeLUT(fr *frame, lut color.Palette) image.Image {
+	rect := image.Rect(0, 0, fr.width, fr.height)
+	if len(lut) <= 256 {
+		img := image.NewPaletted(rect, lut)
+		for n, iters := range fr.iters {
+			img.Pix[n] = uint8(fr.clamp(iters))
+		}
+		return img
+	}
+
+	img := image.NewRGBA(rect)
+	for n, iters := range fr.iters {
+		c := lut[fr.clamp(iters)].(color.RGBA)
+		img.Pix[4*n], img.Pix[4*n+1], img.Pix[4*n+2], img.Pix[4*n+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+// colorizeSmooth maps the fractional iteration counts of a frame through
+// the palette, which avoids the contour bands of integer counts.
+func colorizeSmooth(fr *frame, co colorOptions) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, fr.width, fr.height))
+	for n, iters := range fr.iters {
+		c := color.RGBA{0, 0, 0, 0xff}
+		if iters < uint32(fr.maxIters) {
+			c = co.palette.at(co.offset + co.scale*float64(fr.smooth[n])/float64(fr.maxIters))
+		}
+		img.Pix[4*n], img.Pix[4*n+1], img.Pix[4*n+2], img.Pix[4*n+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
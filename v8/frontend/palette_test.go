@@ -0,0 +1,184 @@
+package main
+
+import (
+	"image/color"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		s   string
+		c   [4]float64
+		err bool
+	}{
+		{"#000000", [4]float64{0, 0, 0, 1}, false},
+		{"#ffffff", [4]float64{1, 1, 1, 1}, false},
+		{"ff0000", [4]float64{1, 0, 0, 1}, false},
+		{"#00ff0080", [4]float64{0, 1, 0, 128.0 / 255}, false},
+		{"#FFAA00", [4]float64{1, 170.0 / 255, 0, 1}, false},
+		{"", [4]float64{}, true},
+		{"#fff", [4]float64{}, true},
+		{"#fffffff", [4]float64{}, true},
+		{"#gggggg", [4]float64{}, true},
+		{"#-fffff", [4]float64{}, true},
+	}
+	for _, tt := range tests {
+		c, err := parseHexColor(tt.s)
+		if (err != nil) != tt.err {
+			t.Errorf("parseHexColor(%q): error %v", tt.s, err)
+			continue
+		}
+		if c != tt.c {
+			t.Errorf("parseHexColor(%q) = %v, want %v", tt.s, c, tt.c)
+		}
+	}
+}
+
+// ggr returns a GIMP gradient with the given segment lines.
+func ggr(segments ...string) string {
+	return "GIMP Gradient\nName: test\n" + strings.Join(segments, "\n") + "\n"
+}
+
+const ggrSegment = "0 0.5 1 0 0 0 1 1 1 1 1 0 0"
+
+func TestReadGGRPalette(t *testing.T) {
+	data := ggr("2", "0 0.25 0.5 0 0 0 1 1 0 0 1 1 0", "0.5 0.75 1 1 0 0 1 0 0 0 1 4 0")
+	for _, cyclic := range []bool{false, true} {
+		pal, err := readGGRPalette(strings.NewReader(data), cyclic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pal.name != "test" || pal.cyclic != cyclic || len(pal.segments) != 2 {
+			t.Fatalf("palette %s cyclic=%v with %d segments", pal.name, pal.cyclic, len(pal.segments))
+		}
+		s := pal.segments[1]
+		if s.left != 0.5 || s.mid != 0.75 || s.right != 1 || s.c0 != [4]float64{1, 0, 0, 1} || s.c1 != [4]float64{0, 0, 0, 1} || s.blend != blendSphereDecreasing {
+			t.Errorf("segment %+v", s)
+		}
+	}
+
+	// The first and last colours match, which does not make a gradient
+	// cyclic.
+	pal, err := readGGRPalette(strings.NewReader(ggr("1", "0 0.5 1 0 0 0 1 0 0 0 1 0 0")), false)
+	if err != nil || pal.cyclic {
+		t.Errorf("gradient ending with its first colour: cyclic=%v error=%v", pal.cyclic, err)
+	}
+}
+
+func TestReadGGRPaletteErrors(t *testing.T) {
+	tests := map[string]string{
+		"empty":          "",
+		"header":         "GIMP Palette\nName: test\n1\n" + ggrSegment + "\n",
+		"name":           "GIMP Gradient\ntest\n1\n" + ggrSegment + "\n",
+		"count":          ggr("x", ggrSegment),
+		"no segments":    ggr("0"),
+		"missing":        ggr("2", ggrSegment),
+		"short segment":  ggr("1", "0 0.5 1 0 0 0 1 1 1 1 1"),
+		"number":         ggr("1", "0 x 1 0 0 0 1 1 1 1 1 0 0"),
+		"blend":          ggr("1", "0 0.5 1 0 0 0 1 1 1 1 1 9 0"),
+		"negative blend": ggr("1", "0 0.5 1 0 0 0 1 1 1 1 1 -1 0"),
+	}
+	for name, data := range tests {
+		if _, err := readGGRPalette(strings.NewReader(data), false); err == nil {
+			t.Errorf("%s: readGGRPalette succeeded", name)
+		}
+	}
+}
+
+func TestSegmentFactor(t *testing.T) {
+	tests := []struct {
+		blend int
+		mid   float64
+		pos   float64
+		want  float64
+	}{
+		{blendLinear, 0.5, 0, 0},
+		{blendLinear, 0.5, 0.25, 0.25},
+		{blendLinear, 0.5, 1, 1},
+		{blendLinear, 0.25, 0.25, 0.5},
+		{blendLinear, 0.25, 0.625, 0.75},
+		{blendCurved, 0.25, 0.25, 0.5},
+		{blendCurved, 0.25, 0.5625, 0.75},
+		{blendSine, 0.5, 0.25, (1 - math.Sqrt2/2) / 2},
+		{blendSine, 0.5, 0.5, 0.5},
+		{blendSphereIncreasing, 0.5, 0.25, math.Sqrt(1 - 0.75*0.75)},
+		{blendSphereIncreasing, 0.5, 1, 1},
+		{blendSphereDecreasing, 0.5, 0.25, 1 - math.Sqrt(1-0.25*0.25)},
+		{blendSphereDecreasing, 0.5, 1, 1},
+		{blendStep, 0.5, 0.49, 0},
+		{blendStep, 0.5, 0.5, 1},
+	}
+	for _, tt := range tests {
+		s := segment{left: 0, mid: tt.mid, right: 1, blend: tt.blend}
+		if got := s.factor(tt.pos); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("blend %d mid %g: factor(%g) = %g, want %g", tt.blend, tt.mid, tt.pos, got, tt.want)
+		}
+	}
+
+	// Segments not starting at 0 blend over their own range.
+	s := segment{left: 0.5, mid: 0.75, right: 1, blend: blendLinear}
+	if got := s.factor(0.625); got != 0.25 {
+		t.Errorf("factor of a segment over [0.5, 1] = %g, want 0.25", got)
+	}
+}
+
+func TestPaletteAt(t *testing.T) {
+	clamped, err := newPalette("clamped", false, []string{"#000000", "#ffffff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cyclic, err := newPalette("cyclic", true, []string{"#000000", "#ffffff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray := func(v uint8) color.RGBA { return color.RGBA{v, v, v, 0xff} }
+	tests := []struct {
+		pal  *palette
+		t    float64
+		want color.RGBA
+	}{
+		{clamped, 0, gray(0)},
+		{clamped, 0.5, gray(128)},
+		{clamped, 1, gray(255)},
+		{clamped, 1.25, gray(255)},
+		{clamped, 7, gray(255)},
+		{clamped, -0.25, gray(0)},
+		{cyclic, 0.25, gray(64)},
+		{cyclic, 1.25, gray(64)},
+		{cyclic, 7.25, gray(64)},
+		{cyclic, -0.25, gray(191)},
+		{cyclic, 1, gray(0)},
+	}
+	for _, tt := range tests {
+		if got := tt.pal.at(tt.t); got != tt.want {
+			t.Errorf("%s.at(%g) = %v, want %v", tt.pal.name, tt.t, got, tt.want)
+		}
+	}
+}
+
+// Gradients of the palette directory are cyclic when CyclicPalettes names
+// them.
+func TestLoadPalettesCyclic(t *testing.T) {
+	defer loadPalettes("", nil)
+	dir := t.TempDir()
+	for _, name := range []string{"wraps", "stops"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name+".ggr"), []byte(ggr("1", ggrSegment)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loadPalettes(dir, []string{"wraps"})
+	for name, want := range map[string]bool{"wraps": true, "stops": false, "classic": true, "gray": false} {
+		pal, ok := getPalette(name)
+		if !ok {
+			t.Errorf("palette %s not loaded", name)
+			continue
+		}
+		if pal.cyclic != want {
+			t.Errorf("palette %s cyclic = %v, want %v", name, pal.cyclic, want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRetryBackoff caps the backoff between retries of a batch.
+const maxRetryBackoff = 5 * time.Second
+
+// maxListedBlocks bounds the failed blocks listed in the X-Failed-Blocks
+// header of a partial frame.
+const maxListedBlocks = 64
+
+// renderState tracks the blocks of a render that could not be computed.
+// The render stops dispatching blocks once the error budget is spent, when
+// err is set or when ctx is done.
+type renderState struct {
+	ctx    context.Context
+	key    string
+	total  int
+	budget int
+	mux    sync.Mutex
+	failed []blockPos
+	err    error
+}
+
+// errorBudget returns the number of blocks out of total that may fail
+// before the render as a whole fails.
+func errorBudget(total int) int {
+	return int(math.Floor(C.ErrorBudget * float64(total)))
+}
+
+func (rs *renderState) fail(blocks []blockPos) {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+	rs.failed = append(rs.failed, blocks...)
+}
+
+// abort fails the render with err, which is returned as it is.
+func (rs *renderState) abort(err error) {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+	if rs.err == nil {
+		rs.err = err
+	}
+}
+
+func (rs *renderState) stopped() bool {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+	return rs.err != nil || len(rs.failed) > rs.budget || rs.ctx.Err() != nil
+}
+
+// budgetError is returned for renders with more failed blocks than the
+// error budget allows.
+type budgetError struct {
+	failed int
+	total  int
+}
+
+func (e *budgetError) Error() string {
+	return fmt.Sprintf("render failed: %d of %d blocks could not be computed", e.failed, e.total)
+}
+
+// retryBackoff returns the delay before retry attempt+1, doubling from
+// RetryBackoff with up to 50% of jitter, up to maxRetryBackoff. Retries
+// are immediate when RetryBackoff is 0.
+func retryBackoff(attempt int) time.Duration {
+	if C.RetryBackoff <= 0 {
+		return 0
+	}
+	d := C.RetryBackoff << uint(attempt)
+	if d>>uint(attempt) != C.RetryBackoff || d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// writeRenderError reports a failed render: requests the backend rejected
+// are the fault of the client, renders past their deadline time out and
+// anything else is a server side failure. Nothing is sent to clients that
+// went away.
+func writeRenderError(w http.ResponseWriter, err error) {
+	switch {
+	case err == context.Canceled:
+		log.Printf("Render canceled: the client went away")
+		return
+	case err == context.DeadlineExceeded:
+		http.Error(w, "render timed out", http.StatusGatewayTimeout)
+		return
+	}
+	if status.Code(err) == codes.InvalidArgument {
+		http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusServiceUnavailable)
+}
+
+// sendFrame colorizes and sends a frame. Partial frames have their missing
+// blocks drawn as a checkerboard and are marked by setPartialHeaders.
+func sendFrame(w http.ResponseWriter, fr *frame, co colorOptions) {
+	img := frameImage(fr, co)
+	if len(fr.failed) > 0 {
+		setPartialHeaders(w, failedBlocks(fr.failed))
+	}
+	sendImage(w, img, http.StatusOK)
+}
+
+// frameImage colorizes a frame, drawing its failed blocks as a
+// checkerboard.
+func frameImage(fr *frame, co colorOptions) image.Image {
+	img := colorize(fr, co)
+	if len(fr.failed) == 0 {
+		return img
+	}
+	return markFailed(img, fr.failed)
+}
+
+// setPartialHeaders marks the response as a partial frame, which must not
+// be cached, missing the failed blocks. Their number is sent in the
+// X-Failed-Block-Count header and the first maxListedBlocks of them in the
+// X-Failed-Blocks header, comma separated.
+func setPartialHeaders(w http.ResponseWriter, failed []string) {
+	listed := failed
+	if len(listed) > maxListedBlocks {
+		listed = listed[:maxListedBlocks]
+	}
+	w.Header().Set("X-Render-Status", "partial")
+	w.Header().Set("X-Failed-Block-Count", strconv.Itoa(len(failed)))
+	w.Header().Set("X-Failed-Blocks", strings.Join(listed, ","))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// failedBlocks formats blocks as x:y block coordinates, sorted by row.
+func failedBlocks(blocks []blockPos) []string {
+	sorted := append([]blockPos{}, blocks...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].y != sorted[j].y {
+			return sorted[i].y < sorted[j].y
+		}
+		return sorted[i].x < sorted[j].x
+	})
+	ids := make([]string, len(sorted))
+	for n, bp := range sorted {
+		ids[n] = fmt.Sprintf("%d:%d", bp.x, bp.y)
+	}
+	return ids
+}
+
+// markFailed draws a checkerboard over the failed blocks of img, so they
+// cannot be mistaken for points inside the set.
+func markFailed(img image.Image, blocks []blockPos) image.Image {
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	light := color.RGBA{0x80, 0x80, 0x80, 0xff}
+	dark := color.RGBA{0x40, 0x40, 0x40, 0xff}
+	for _, bp := range blocks {
+		r := image.Rect(bp.x*blockSize, bp.y*blockSize, (bp.x+1)*blockSize, (bp.y+1)*blockSize).Intersect(out.Bounds())
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if (x/8+y/8)%2 == 0 {
+					out.SetRGBA(x, y, light)
+				} else {
+					out.SetRGBA(x, y, dark)
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	defer func(backoff time.Duration) { C.RetryBackoff = backoff }(C.RetryBackoff)
+
+	tests := []struct {
+		backoff  time.Duration
+		attempt  int
+		min, max time.Duration
+	}{
+		{0, 0, 0, 0},
+		{0, 10, 0, 0},
+		{100 * time.Millisecond, 0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{100 * time.Millisecond, 2, 200 * time.Millisecond, 400 * time.Millisecond},
+		{100 * time.Millisecond, 10, maxRetryBackoff / 2, maxRetryBackoff},
+		{time.Second, 40, maxRetryBackoff / 2, maxRetryBackoff},
+		{time.Second, 70, maxRetryBackoff / 2, maxRetryBackoff},
+		{time.Hour, 0, maxRetryBackoff / 2, maxRetryBackoff},
+	}
+	for _, tt := range tests {
+		C.RetryBackoff = tt.backoff
+		for n := 0; n < 20; n++ {
+			if d := retryBackoff(tt.attempt); d < tt.min || d > tt.max {
+				t.Errorf("retryBackoff(%d) with RetryBackoff=%s = %s, want [%s, %s]", tt.attempt, tt.backoff, d, tt.min, tt.max)
+				break
+			}
+		}
+	}
+}
+
+func TestSetPartialHeaders(t *testing.T) {
+	var blocks []blockPos
+	for n := 0; n < 100; n++ {
+		blocks = append(blocks, blockPos{n % 10, 9 - n/10})
+	}
+	w := httptest.NewRecorder()
+	setPartialHeaders(w, failedBlocks(blocks))
+
+	h := w.Header()
+	if h.Get("X-Render-Status") != "partial" || h.Get("X-Failed-Block-Count") != "100" || h.Get("Cache-Control") != "no-store" {
+		t.Errorf("headers = %v", h)
+	}
+	listed := strings.Split(h.Get("X-Failed-Blocks"), ",")
+	if len(listed) != maxListedBlocks || listed[0] != "0:0" || listed[1] != "1:0" || listed[10] != "0:1" {
+		t.Errorf("X-Failed-Blocks = %d blocks starting %v, want the first %d by row", len(listed), listed[:11], maxListedBlocks)
+	}
+}
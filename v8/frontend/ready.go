@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+)
+
+// The states of a readiness check. Degraded and skipped checks do not make
+// the frontend unready.
+const (
+	checkOK       = "ok"
+	checkDegraded = "degraded"
+	checkSkipped  = "skipped"
+	checkFailed   = "failed"
+)
+
+// readyStaleAfter is the age past which the health of the backends,
+// checked in the background every 10 seconds, is not trusted any more.
+const readyStaleAfter = 30 * time.Second
+
+// readyCheck is the outcome of one readiness check.
+type readyCheck struct {
+	State     string  `json:"state"`
+	LatencyMs float64 `json:"latencyMs"`
+	Detail    string  `json:"detail,omitempty"`
+}
+
+var (
+	readyMux  sync.Mutex
+	configErr error
+	draining  bool
+)
+
+// setConfigError records the outcome of the last configuration load.
+func setConfigError(err error) {
+	readyMux.Lock()
+	defer readyMux.Unlock()
+	configErr = err
+}
+
+func isDraining() bool {
+	readyMux.Lock()
+	defer readyMux.Unlock()
+	return draining
+}
+
+// validateConfig returns the problems of the configuration in C that were
+// not corrected while it was read, with fileErr, the error parsing the
+// configuration file.
+func validateConfig(fileErr error) error {
+	var problems []string
+	if fileErr != nil {
+		problems = append(problems, fileErr.Error())
+	}
+	if C.Points < 1 || C.Points > maxPoints {
+		problems = append(problems, fmt.Sprintf("Points out of range [1, %d]: %d", maxPoints, C.Points))
+	}
+	if C.MaxIters < 1 || C.MaxIters > iterLimit {
+		problems = append(problems, fmt.Sprintf("MaxIters out of range [1, %d]: %d", iterLimit, C.MaxIters))
+	}
+	if _, ok := getPalette(C.Palette); !ok {
+		problems = append(problems, fmt.Sprintf("unknown Palette: %s", C.Palette))
+	}
+	if C.ErrorBudget < 0 || C.ErrorBudget > 1 {
+		problems = append(problems, fmt.Sprintf("ErrorBudget out of range [0, 1]: %g", C.ErrorBudget))
+	}
+	for _, name := range C.Cache {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "memory", "redis", "disk", "", "none":
+		default:
+			problems = append(problems, fmt.Sprintf("unknown Cache level: %s", name))
+		}
+	}
+	switch strings.ToLower(C.BlockOrder) {
+	case "rowmajor", "spiral", "hilbert":
+	default:
+		problems = append(problems, fmt.Sprintf("unknown BlockOrder: %s", C.BlockOrder))
+	}
+	switch strings.ToLower(strings.TrimSpace(C.JobStore)) {
+	case "memory", "redis":
+	default:
+		problems = append(problems, fmt.Sprintf("unknown JobStore: %s", C.JobStore))
+	}
+	for _, c := range []struct{ name, v string }{{"WireCompression", C.WireCompression}, {"CacheCompression", C.CacheCompression}} {
+		if _, ok := pb.Compression_value[strings.ToUpper(c.v)]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown %s: %s", c.name, c.v))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(problems, "; "))
+}
+
+// timeCheck runs a check and records how long it took.
+func timeCheck(check func() readyCheck) readyCheck {
+	start := time.Now()
+	rc := check()
+	rc.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+	return rc
+}
+
+// checkBackends reports the health of the backends as last checked in the
+// background, at least one of which must be serving unless blocks are only
+// computed in-process. The check fails when the health is older than
+// readyStaleAfter.
+func checkBackends() readyCheck {
+	if C.Standalone {
+		return readyCheck{State: checkSkipped, Detail: "standalone"}
+	}
+	checked := backends.refreshed()
+	if checked.IsZero() {
+		return readyCheck{State: checkFailed, Detail: "not checked yet"}
+	}
+	online, total := backends.online()
+	age := time.Since(checked).Round(time.Second)
+	detail := fmt.Sprintf("%d/%d serving, checked %s ago", online, total, age)
+	if online == 0 || age > readyStaleAfter {
+		return readyCheck{State: checkFailed, Detail: detail}
+	}
+	return readyCheck{State: checkOK, Detail: detail}
+}
+
+// checkCache reports whether every cache level was reachable when last
+// connected to in the background. Unreachable levels only degrade the
+// frontend when the cache is optional.
+func checkCache() readyCheck {
+	tc, ok := currentCache().(*tieredCache)
+	if !ok || len(tc.levels) == 0 {
+		return readyCheck{State: checkSkipped, Detail: "no cache"}
+	}
+	var offline []string
+	for _, l := range tc.levels {
+		if !l.Online() {
+			offline = append(offline, l.Name())
+		}
+	}
+	switch {
+	case len(offline) == 0:
+		return readyCheck{State: checkOK, Detail: tc.Name()}
+	case C.CacheOptional:
+		return readyCheck{State: checkDegraded, Detail: "unreachable: " + strings.Join(offline, ", ")}
+	}
+	return readyCheck{State: checkFailed, Detail: "unreachable: " + strings.Join(offline, ", ")}
+}
+
+func checkConfig() readyCheck {
+	readyMux.Lock()
+	defer readyMux.Unlock()
+	if configErr != nil {
+		return readyCheck{State: checkFailed, Detail: configErr.Error()}
+	}
+	if f := viper.ConfigFileUsed(); f != "" {
+		return readyCheck{State: checkOK, Detail: f}
+	}
+	return readyCheck{State: checkOK, Detail: "defaults"}
+}
+
+func checkDraining() readyCheck {
+	if isDraining() {
+		return readyCheck{State: checkFailed, Detail: "shutting down"}
+	}
+	return readyCheck{State: checkOK}
+}
+
+// viewReady reports whether the frontend should receive traffic: a backend
+// is serving, the cache is reachable or optional, the configuration was
+// loaded and is valid and the frontend is not shutting down. It replies 200
+// when it is ready and 503 otherwise, with the outcome of every check.
+func viewReady(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]readyCheck{
+		"backends": timeCheck(checkBackends),
+		"cache":    timeCheck(checkCache),
+		"config":   timeCheck(checkConfig),
+		"draining": timeCheck(checkDraining),
+	}
+
+	readyOut := struct {
+		Status string                `json:"status"`
+		Checks map[string]readyCheck `json:"checks"`
+	}{Status: "ready", Checks: checks}
+	statusCode := http.StatusOK
+	for _, rc := range checks {
+		if rc.State == checkFailed {
+			readyOut.Status = "not ready"
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	data, err := json.MarshalIndent(&readyOut, "", "  ")
+	if err != nil {
+		log.Println(err)
+	}
+	w.Write(data)
+}
+
+// drainOnSignal shuts srv down on SIGTERM or an interrupt. The frontend
+// first reports itself unready for DrainTimeout, so it is taken out of
+// rotation, then waits up to DrainTimeout for the requests in flight.
+func drainOnSignal(srv *http.Server) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	s := <-sig
+
+	readyMux.Lock()
+	draining = true
+	readyMux.Unlock()
+	log.Printf("Draining: signal=%s timeout=%s", s, C.DrainTimeout)
+	time.Sleep(C.DrainTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), C.DrainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Http server shutdown failed: msg=%s", err)
+	}
+	log.Printf("Stopped mandelbrot frontend")
+	os.Exit(0)
+}
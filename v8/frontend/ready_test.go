@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// checkBackends reports the health found in the background, without
+// checking the backends itself.
+func TestCheckBackends(t *testing.T) {
+	defer func(bp *backendPool, standalone bool) { backends, C.Standalone = bp, standalone }(backends, C.Standalone)
+	C.Standalone = false
+	backends = newBackendPool()
+	defer backends.update(nil, false)
+
+	if rc := checkBackends(); rc.State != checkFailed || rc.Detail != "not checked yet" {
+		t.Errorf("before the first check: %+v", rc)
+	}
+
+	backends.update([]string{"127.0.0.1:1"}, false)
+	backends.lastRefresh = time.Now()
+	if rc := checkBackends(); rc.State != checkFailed || !strings.HasPrefix(rc.Detail, "0/1 serving") {
+		t.Errorf("no backend serving: %+v", rc)
+	}
+	backends.backends["127.0.0.1:1"].online = true
+	if rc := checkBackends(); rc.State != checkOK || !strings.HasPrefix(rc.Detail, "1/1 serving") {
+		t.Errorf("a backend serving: %+v", rc)
+	}
+	backends.lastRefresh = time.Now().Add(-2 * readyStaleAfter)
+	if rc := checkBackends(); rc.State != checkFailed {
+		t.Errorf("stale health: %+v", rc)
+	}
+
+	C.Standalone = true
+	if rc := checkBackends(); rc.State != checkSkipped {
+		t.Errorf("standalone: %+v", rc)
+	}
+}
+
+// A configuration that cannot be read or decoded on reload keeps the
+// current one and fails the config check.
+func TestReadConfigReloadError(t *testing.T) {
+	defer func(c config) { C = c; setConfigError(nil) }(C)
+	dir := t.TempDir()
+
+	for name, data := range map[string]string{
+		"unparsable":  "Points: [",
+		"undecodable": "Points: many",
+	} {
+		file := filepath.Join(dir, name+".yml")
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		viper.SetConfigFile(file)
+		C = config{Points: 1234}
+		setConfigError(nil)
+		if readConfig(true) {
+			t.Errorf("%s: reload applied", name)
+		}
+		if C.Points != 1234 {
+			t.Errorf("%s: Points = %d after a failed reload, want 1234", name, C.Points)
+		}
+		if rc := checkConfig(); rc.State != checkFailed {
+			t.Errorf("%s: config check %+v", name, rc)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/mediocregopher/radix.v2/pool"
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// redisClient is a pool of connections to a redis server, shared by the
+// block cache and the job store.
+type redisClient struct {
+	server string
+	mux    sync.RWMutex
+	pool   *pool.Pool
+	online bool
+}
+
+// errRedisOffline is returned by commands run before the first connection
+// to the redis server.
+var errRedisOffline = errors.New("redis server is not connected")
+
+// cmd runs a command on the current connection pool.
+func (c *redisClient) cmd(cmd string, args ...interface{}) *redis.Resp {
+	c.mux.RLock()
+	p := c.pool
+	c.mux.RUnlock()
+
+	if p == nil {
+		return &redis.Resp{Err: errRedisOffline}
+	}
+	return p.Cmd(cmd, args...)
+}
+
+func (c *redisClient) Online() bool {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.online
+}
+
+// connect dials the redis server when it is not connected yet, or when
+// retry forces a new connection, and otherwise checks the connection with a
+// PING. Replaced pools are emptied. The server is only talked to with c.mux
+// unlocked, so that commands are not held up by a slow server.
+func (c *redisClient) connect(retry bool) {
+	c.mux.RLock()
+	p, online := c.pool, c.online
+	c.mux.RUnlock()
+
+	if online && !retry {
+		pong, err := p.Cmd("PING").Str()
+		if err != nil || pong != "PONG" {
+			c.mux.Lock()
+			if c.pool == p {
+				c.online = false
+			}
+			c.mux.Unlock()
+			log.Printf("Redis server is not reachable: error=%s\n", err)
+		}
+		return
+	}
+
+	np, err := pool.New("tcp", c.server, 10)
+	c.mux.Lock()
+	old := c.pool
+	if err == nil {
+		c.pool, c.online = np, true
+	} else if online {
+		c.pool, c.online = nil, false
+	} else {
+		old = nil
+	}
+	c.mux.Unlock()
+	if old != nil {
+		old.Empty()
+	}
+
+	switch {
+	case err == nil && online:
+		log.Printf("Redis server is online (retry)")
+	case err == nil:
+		log.Printf("Redis server is online")
+	case online:
+		log.Printf("Redis server is not reachable (retry): error=%s\n", err)
+	}
+}
+
+// close empties the connection pool of a client that is no longer used.
+func (c *redisClient) close() {
+	c.mux.Lock()
+	p := c.pool
+	c.pool, c.online = nil, false
+	c.mux.Unlock()
+	if p != nil {
+		p.Empty()
+	}
+}
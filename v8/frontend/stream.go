@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"image/png"
+	"log"
+	"net/http"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultPreviewScale is the factor the preview of a stream is
+	// smaller than the image by.
+	defaultPreviewScale = 8
+	maxPreviewScale     = 64
+)
+
+// streamStart, streamPreview, streamBlock and streamDone are the data of
+// the events of a stream. Images are PNG encoded, in base64 in JSON.
+type streamStart struct {
+	Width     int `json:"width"`
+	Height    int `json:"height"`
+	BlockSize int `json:"blockSize"`
+	Blocks    int `json:"blocks"`
+}
+
+type streamPreview struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Scale  int    `json:"scale"`
+	Image  []byte `json:"image"`
+}
+
+// streamBlock is block (X, Y), whose top left pixel is at (Left, Top) of
+// the image.
+type streamBlock struct {
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Left   int    `json:"left"`
+	Top    int    `json:"top"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Cached bool   `json:"cached"`
+	Image  []byte `json:"image"`
+}
+
+type streamDone struct {
+	Blocks       int      `json:"blocks"`
+	FailedBlocks []string `json:"failedBlocks,omitempty"`
+}
+
+type streamError struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// eventWriter writes server-sent events, flushing each one.
+type eventWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (ew *eventWriter) send(event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(ew.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	ew.flusher.Flush()
+	return nil
+}
+
+// encodeBlockImage colorizes the block at bp of fr and encodes it as PNG.
+// Blocks without smooth counts are colorized through lut, the colorLUT of
+// the frame.
+func encodeBlockImage(fr *frame, bp blockPos, b block, co colorOptions, lut color.Palette) ([]byte, error) {
+	w, h := fr.blockDims(bp.x, bp.y)
+	bf := &frame{width: w, height: h, maxIters: fr.maxIters, iters: make([]uint32, w*h)}
+	if b.Smooth != nil {
+		bf.smooth = make([]float32, w*h)
+	}
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			bf.iters[y*w+x] = b.Rectangle[x][y]
+			if bf.smooth != nil {
+				bf.smooth[y*w+x] = b.Smooth[x][y]
+			}
+		}
+	}
+	img := colorizeLUT(bf, lut)
+	if bf.smooth != nil {
+		img = colorizeSmooth(bf, co)
+	}
+	buffer := new(bytes.Buffer)
+	err := png.Encode(buffer, img)
+	return buffer.Bytes(), err
+}
+
+// previewRequest returns the request of the preview of rr, scale times
+// smaller over the same region.
+func previewRequest(rr renderRequest, scale int) renderRequest {
+	pr := rr
+	pr.width = (rr.width + scale - 1) / scale
+	pr.height = (rr.height + scale - 1) / scale
+	return pr
+}
+
+// streamHandler renders progressively as server-sent events, taking the
+// parameters of /render, or with c those of /julia. A start event gives the
+// size of the image and a preview event a render of it preview (8) times
+// smaller, unless preview is 0 or 1. A block event follows for every block
+// as it is found in the cache or computed. The stream ends with a done
+// event, or an error event when the render fails. The preview is rendered
+// alongside the image, whose blocks are held back until it is sent. It is
+// left out when the image is done first.
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	rr, co, err := queryRenderRequest(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	scale, err := intParam(q, "preview", defaultPreviewScale, 0, maxPreviewScale)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !renderReady(w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	ew := &eventWriter{w: w, flusher: flusher}
+
+	ctx, cancel := renderContext(r)
+	defer cancel()
+
+	cols, rows := blockGrid(rr.width, rr.height)
+	if ew.send("start", streamStart{Width: rr.width, Height: rr.height, BlockSize: blockSize, Blocks: cols * rows}) != nil {
+		return
+	}
+
+	type result struct {
+		fr  *frame
+		err error
+	}
+	var previews chan result
+	if scale > 1 {
+		previews = make(chan result, 1)
+		go func() {
+			fr, err := calculateMandel(ctx, previewRequest(rr, scale), nil)
+			previews <- result{fr, err}
+		}()
+	}
+
+	// Blocks are encoded by the goroutines computing them and sent one
+	// at a time. A client that went away cancels the render.
+	blocks := make(chan streamBlock, 64)
+	layout := &frame{width: rr.width, height: rr.height, maxIters: rr.maxIters}
+	var lut color.Palette
+	if !rr.smooth {
+		lut = colorLUT(rr.maxIters, co)
+	}
+	observe := func(bp blockPos, b block, cached bool) {
+		img, err := encodeBlockImage(layout, bp, b, co, lut)
+		if err != nil {
+			log.Printf("Unable to encode block: x=%d y=%d error=%s", bp.x, bp.y, err)
+			return
+		}
+		w, h := layout.blockDims(bp.x, bp.y)
+		sb := streamBlock{X: bp.x, Y: bp.y, Left: bp.x * blockSize, Top: bp.y * blockSize, Width: w, Height: h, Cached: cached, Image: img}
+		select {
+		case blocks <- sb:
+		case <-ctx.Done():
+		}
+	}
+	finished := make(chan result, 1)
+	go func() {
+		fr, err := calculateMandel(ctx, rr, observe)
+		finished <- result{fr, err}
+	}()
+
+	// pending holds the blocks computed before the preview was sent.
+	var pending []streamBlock
+	for {
+		select {
+		case res := <-previews:
+			previews = nil
+			if res.err != nil {
+				sendStreamError(ew, res.err)
+				return
+			}
+			buffer := new(bytes.Buffer)
+			if err := png.Encode(buffer, frameImage(res.fr, co)); err != nil {
+				sendStreamError(ew, err)
+				return
+			}
+			if ew.send("preview", streamPreview{Width: res.fr.width, Height: res.fr.height, Scale: scale, Image: buffer.Bytes()}) != nil {
+				return
+			}
+			for _, sb := range pending {
+				if ew.send("block", sb) != nil {
+					return
+				}
+			}
+			pending = nil
+		case sb := <-blocks:
+			if previews != nil {
+				pending = append(pending, sb)
+			} else if ew.send("block", sb) != nil {
+				cancel()
+			}
+		case res := <-finished:
+			for len(blocks) > 0 {
+				pending = append(pending, <-blocks)
+			}
+			for _, sb := range pending {
+				if ew.send("block", sb) != nil {
+					return
+				}
+			}
+			if res.err != nil {
+				sendStreamError(ew, res.err)
+				return
+			}
+			ew.send("done", streamDone{Blocks: cols * rows, FailedBlocks: failedBlocks(res.fr.failed)})
+			return
+		}
+	}
+}
+
+// sendStreamError ends a stream with the error of a failed render, with
+// the status writeRenderError would have replied with.
+func sendStreamError(ew *eventWriter, err error) {
+	se := streamError{Status: http.StatusServiceUnavailable, Error: err.Error()}
+	switch {
+	case err == context.Canceled:
+		log.Printf("Render canceled: the client went away")
+		return
+	case err == context.DeadlineExceeded:
+		se = streamError{Status: http.StatusGatewayTimeout, Error: "render timed out"}
+	case status.Code(err) == codes.InvalidArgument:
+		se = streamError{Status: http.StatusBadRequest, Error: status.Convert(err).Message()}
+	}
+	ew.send("error", se)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// useStandalone renders in-process with a memory cache until the test ends.
+func useStandalone(t *testing.T) {
+	saved := C
+	t.Cleanup(func() {
+		C = saved
+		setupCache()
+		setupLimiters()
+	})
+	C = config{
+		Points:           64,
+		MaxIters:         50,
+		EscapeRadius:     2,
+		Standalone:       true,
+		Cache:            []string{"memory"},
+		CacheMemoryBytes: 1 << 20,
+		CacheConcurrency: 4,
+		BlocksPerRPC:     4,
+		MaxInflight:      2,
+		ErrorBudget:      0.1,
+		Palette:          "gray",
+		PaletteScale:     1,
+	}
+	setupCache()
+	setupLimiters()
+}
+
+type event struct {
+	name string
+	data []byte
+}
+
+// parseEvents splits a server-sent event stream into its events, each of
+// an event and a data line followed by a blank line.
+func parseEvents(t *testing.T, body string) []event {
+	if !strings.HasSuffix(body, "\n\n") {
+		t.Fatalf("stream does not end with a blank line: %q", body)
+	}
+	var events []event
+	for _, chunk := range strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n") {
+		lines := strings.Split(chunk, "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[0], "event: ") || !strings.HasPrefix(lines[1], "data: ") {
+			t.Fatalf("malformed event: %q", chunk)
+		}
+		events = append(events, event{strings.TrimPrefix(lines[0], "event: "), []byte(strings.TrimPrefix(lines[1], "data: "))})
+	}
+	return events
+}
+
+func TestStreamEvents(t *testing.T) {
+	useStandalone(t)
+	for _, preview := range []int{4, 0} {
+		url := "/stream?cx=-0.5&cy=0&span=3&width=80&height=40&preview=" + strconv.Itoa(preview)
+		w := httptest.NewRecorder()
+		streamHandler(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("%s: status %d, content type %q", url, w.Code, w.Header().Get("Content-Type"))
+		}
+		events := parseEvents(t, w.Body.String())
+
+		var names []string
+		for _, e := range events {
+			if len(names) == 0 || names[len(names)-1] != e.name {
+				names = append(names, e.name)
+			}
+		}
+		want := "start,preview,block,done"
+		if preview == 0 {
+			want = "start,block,done"
+		}
+		if got := strings.Join(names, ","); got != want {
+			t.Fatalf("%s: events %s, want %s", url, got, want)
+		}
+
+		var start streamStart
+		json.Unmarshal(events[0].data, &start)
+		if start.Width != 80 || start.Height != 40 || start.BlockSize != blockSize || start.Blocks != 6 {
+			t.Errorf("%s: start %+v", url, start)
+		}
+		if preview > 0 {
+			var p streamPreview
+			json.Unmarshal(events[1].data, &p)
+			if p.Width != 20 || p.Height != 10 || p.Scale != 4 {
+				t.Errorf("%s: preview of %dx%d, scale %d", url, p.Width, p.Height, p.Scale)
+			}
+		}
+
+		seen := make(map[[2]int]bool)
+		for _, e := range events {
+			if e.name != "block" {
+				continue
+			}
+			var sb streamBlock
+			if err := json.Unmarshal(e.data, &sb); err != nil {
+				t.Fatal(err)
+			}
+			img, err := png.Decode(bytes.NewReader(sb.Image))
+			if err != nil {
+				t.Fatalf("block %d:%d: %s", sb.X, sb.Y, err)
+			}
+			wantW, wantH := 32, 32
+			if sb.X == 2 {
+				wantW = 16
+			}
+			if sb.Y == 1 {
+				wantH = 8
+			}
+			if b := img.Bounds(); sb.Width != wantW || sb.Height != wantH || b.Dx() != wantW || b.Dy() != wantH {
+				t.Errorf("block %d:%d of %dx%d, image %v, want %dx%d", sb.X, sb.Y, sb.Width, sb.Height, b, wantW, wantH)
+			}
+			if sb.Left != sb.X*blockSize || sb.Top != sb.Y*blockSize {
+				t.Errorf("block %d:%d drawn at %d,%d", sb.X, sb.Y, sb.Left, sb.Top)
+			}
+			seen[[2]int{sb.X, sb.Y}] = true
+		}
+		if len(seen) != 6 {
+			t.Errorf("%s: %d distinct blocks, want 6", url, len(seen))
+		}
+
+		var done streamDone
+		json.Unmarshal(events[len(events)-1].data, &done)
+		if done.Blocks != 6 || len(done.FailedBlocks) != 0 {
+			t.Errorf("%s: done %+v", url, done)
+		}
+	}
+}
+
+// cancelingRecorder cancels the request once the first block was written,
+// as a client going away does.
+type cancelingRecorder struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (cr *cancelingRecorder) Write(p []byte) (int, error) {
+	if bytes.HasPrefix(p, []byte("event: block")) {
+		cr.cancel()
+	}
+	return cr.ResponseRecorder.Write(p)
+}
+
+func TestStreamCanceled(t *testing.T) {
+	useStandalone(t)
+	C.MaxIters = 100000
+	C.LocalWorkers = 1
+	setupLimiters()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := httptest.NewRequest("GET", "/stream?cx=-0.75&cy=0&span=0.5&width=512&height=512&preview=0", nil).WithContext(ctx)
+	w := &cancelingRecorder{httptest.NewRecorder(), cancel}
+	returned := make(chan struct{})
+	go func() {
+		streamHandler(w, r)
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the stream kept going after the client went away")
+	}
+
+	for _, e := range parseEvents(t, w.Body.String()) {
+		if e.name == "done" || e.name == "error" {
+			t.Errorf("%s event sent to a client that went away", e.name)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+)
+
+const (
+	tileSize    int = 256
+	maxTileZoom int = 36
+)
+
+// At zoom level 0 a single tile covers the square with top left corner
+// tileOrigin (juliaTileOrigin for Julia sets) and side tileSpan. Every
+// zoom level halves the tile side.
+const (
+	tileOrigin      complex128 = (-2.5 + 2i)
+	juliaTileOrigin complex128 = (-2.0 + 2i)
+	tileSpan        float64    = 4.0
+)
+
+// tileRenderRequest maps web map tile coordinates onto the complex plane.
+// Tile rows grow downwards, so the imaginary part decreases with y.
+func tileRenderRequest(kind pb.FractalKind, z int, x int, y int) renderRequest {
+	origin := tileOrigin
+	if kind == pb.FractalKind_JULIA {
+		origin = juliaTileOrigin
+	}
+	span := tileSpan / float64(uint64(1)<<uint(z))
+	start := origin + complex(float64(x)*span, -float64(y)*span)
+
+	return renderRequest{
+		kind:         kind,
+		pStart:       start,
+		pEnd:         start + complex(span, -span),
+		width:        tileSize,
+		height:       tileSize,
+		maxIters:     C.MaxIters,
+		smooth:       C.Smooth,
+		escapeRadius: C.EscapeRadius,
+	}
+}
+
+// parseTilePath extracts the tile coordinates from a /tiles/{z}/{x}/{y}.png path.
+func parseTilePath(path string) (int, int, int, error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/tiles/"), "/")
+	if len(parts) != 3 || !strings.HasSuffix(parts[2], ".png") {
+		return 0, 0, 0, fmt.Errorf("invalid tile path: %s", path)
+	}
+	parts[2] = strings.TrimSuffix(parts[2], ".png")
+
+	var coords [3]int
+	for n, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 {
+			return 0, 0, 0, fmt.Errorf("invalid tile path: %s", path)
+		}
+		coords[n] = v
+	}
+
+	z, x, y := coords[0], coords[1], coords[2]
+	if z > maxTileZoom {
+		return 0, 0, 0, fmt.Errorf("tile zoom out of range [0, %d]: %d", maxTileZoom, z)
+	}
+	if x >= 1<<uint(z) || y >= 1<<uint(z) {
+		return 0, 0, 0, fmt.Errorf("tile out of range: z=%d x=%d y=%d", z, x, y)
+	}
+
+	return z, x, y, nil
+}
+
+func tileHandler(w http.ResponseWriter, r *http.Request) {
+	z, x, y, err := parseTilePath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	kind := pb.FractalKind_MANDELBROT
+	if r.URL.Query().Get("c") != "" {
+		kind = pb.FractalKind_JULIA
+	}
+	rr := tileRenderRequest(kind, z, x, y)
+	if rr.c, err = complexParam(r.URL.Query(), "c", 0); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = parseFractalParams(r.URL.Query(), &rr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	co, err := parseColorOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !renderReady(w) {
+		return
+	}
+
+	ctx, cancel := renderContext(r)
+	defer cancel()
+	fr, err := calculateMandel(ctx, rr, nil)
+	if err != nil {
+		writeRenderError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	sendFrame(w, fr, co)
+}
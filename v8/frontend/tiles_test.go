@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+)
+
+func TestTileRenderRequest(t *testing.T) {
+	tests := []struct {
+		kind    pb.FractalKind
+		z, x, y int
+		start   complex128
+		end     complex128
+	}{
+		{pb.FractalKind_MANDELBROT, 0, 0, 0, -2.5 + 2i, 1.5 - 2i},
+		{pb.FractalKind_MANDELBROT, 1, 0, 0, -2.5 + 2i, -0.5 + 0i},
+		{pb.FractalKind_MANDELBROT, 1, 1, 0, -0.5 + 2i, 1.5 + 0i},
+		{pb.FractalKind_MANDELBROT, 1, 0, 1, -2.5 + 0i, -0.5 - 2i},
+		{pb.FractalKind_MANDELBROT, 2, 3, 1, 0.5 + 1i, 1.5 + 0i},
+		{pb.FractalKind_JULIA, 0, 0, 0, -2 + 2i, 2 - 2i},
+		{pb.FractalKind_JULIA, 1, 1, 1, 0 + 0i, 2 - 2i},
+	}
+	for _, tt := range tests {
+		rr := tileRenderRequest(tt.kind, tt.z, tt.x, tt.y)
+		if rr.pStart != tt.start || rr.pEnd != tt.end {
+			t.Errorf("tile %s %d/%d/%d = %v..%v, want %v..%v", tt.kind, tt.z, tt.x, tt.y, rr.pStart, rr.pEnd, tt.start, tt.end)
+		}
+		if rr.width != tileSize || rr.height != tileSize || rr.kind != tt.kind {
+			t.Errorf("tile %s %d/%d/%d = %dx%d %s", tt.kind, tt.z, tt.x, tt.y, rr.width, rr.height, rr.kind)
+		}
+	}
+}
+
+// Neighbouring tiles share their edges and the tiles of a zoom level cover
+// the tile of the level above.
+func TestTileRenderRequestNeighbours(t *testing.T) {
+	for z := 0; z <= maxTileZoom; z += 6 {
+		n := 1 << uint(z)
+		for _, xy := range [][2]int{{0, 0}, {n / 2, n / 3}, {n - 2, n - 2}} {
+			x, y := xy[0], xy[1]
+			if x+1 >= n || y+1 >= n {
+				continue
+			}
+			rr := tileRenderRequest(pb.FractalKind_MANDELBROT, z, x, y)
+			right := tileRenderRequest(pb.FractalKind_MANDELBROT, z, x+1, y)
+			below := tileRenderRequest(pb.FractalKind_MANDELBROT, z, x, y+1)
+			if real(right.pStart) != real(rr.pEnd) || imag(right.pStart) != imag(rr.pStart) {
+				t.Errorf("tile %d/%d/%d and its right neighbour do not share an edge", z, x, y)
+			}
+			if imag(below.pStart) != imag(rr.pEnd) || real(below.pStart) != real(rr.pStart) {
+				t.Errorf("tile %d/%d/%d and the one below it do not share an edge", z, x, y)
+			}
+			child := tileRenderRequest(pb.FractalKind_MANDELBROT, z+1, 2*x+1, 2*y+1)
+			if child.pEnd != rr.pEnd {
+				t.Errorf("tile %d/%d/%d does not end where its last child ends", z, x, y)
+			}
+		}
+	}
+}
+
+func TestParseTilePath(t *testing.T) {
+	z, x, y, err := parseTilePath("/tiles/3/5/7.png")
+	if err != nil || z != 3 || x != 5 || y != 7 {
+		t.Errorf("parseTilePath = %d/%d/%d %v, want 3/5/7", z, x, y, err)
+	}
+	for _, path := range []string{
+		"/tiles/0/0/0",
+		"/tiles/0/0.png",
+		"/tiles/0/0/0/0.png",
+		"/tiles/a/0/0.png",
+		"/tiles/1/-1/0.png",
+		"/tiles/1/2/0.png",
+		"/tiles/1/0/2.png",
+		"/tiles/37/0/0.png",
+	} {
+		if _, _, _, err := parseTilePath(path); err == nil {
+			t.Errorf("parseTilePath(%q) succeeded", path)
+		}
+	}
+}
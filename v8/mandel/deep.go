@@ -0,0 +1,191 @@
+package mandel
+
+import (
+	"fmt"
+	"math/big"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// deepGuardBits are added to the bits needed to resolve a pixel step,
+	// so rounding errors do not accumulate into visible noise.
+	deepGuardBits uint = 64
+	// deepMaxPrec bounds the precision, and with it the cost, of a request.
+	deepMaxPrec uint = 4096
+)
+
+// deepPrecision returns the mantissa bits needed to tell apart points that
+// are step apart around a center of magnitude up to 2^centerExp.
+func deepPrecision(step *big.Float, centerExp int) (uint, error) {
+	if step.Sign() <= 0 {
+		return 0, fmt.Errorf("pixel step must be positive")
+	}
+	bits := centerExp - step.MantExp(nil)
+	if bits < 0 {
+		bits = 0
+	}
+	prec := uint(bits) + deepGuardBits
+	if prec > deepMaxPrec {
+		return 0, fmt.Errorf("zoom too deep: %d bits of precision needed, at most %d supported", prec, deepMaxPrec)
+	}
+	return prec, nil
+}
+
+// deepViewport is a DeepViewport parsed at the precision it needs. re0
+// and im0 are the coordinates of pixel (0, 0).
+type deepViewport struct {
+	prec  uint
+	cx    *big.Float
+	cy    *big.Float
+	re0   *big.Float
+	im0   *big.Float
+	step  *big.Float
+	fstep float64
+}
+
+func parseDeepViewport(vp Viewport) (*deepViewport, error) {
+	parse := func(name string, v string) (*big.Float, error) {
+		f, _, err := big.ParseFloat(v, 10, deepMaxPrec, big.ToNearestEven)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q", name, v)
+		}
+		return f, nil
+	}
+
+	cx, err := parse("centerX", vp.Deep.CenterX)
+	if err != nil {
+		return nil, err
+	}
+	cy, err := parse("centerY", vp.Deep.CenterY)
+	if err != nil {
+		return nil, err
+	}
+	span, err := parse("span", vp.Deep.Span)
+	if err != nil {
+		return nil, err
+	}
+	step := new(big.Float).Quo(span, new(big.Float).SetInt64(int64(vp.Width)))
+	centerExp := 1
+	for _, f := range []*big.Float{cx, cy} {
+		if exp := f.MantExp(nil); f.Sign() != 0 && exp > centerExp {
+			centerExp = exp
+		}
+	}
+	prec, err := deepPrecision(step, centerExp)
+	if err != nil {
+		return nil, err
+	}
+
+	half := new(big.Float).SetPrec(prec).Quo(span, big.NewFloat(2))
+	halfHeight := half
+	if vp.Height != vp.Width {
+		halfHeight = new(big.Float).SetPrec(prec).SetInt64(int64(vp.Height))
+		halfHeight.Mul(halfHeight, step).Quo(halfHeight, big.NewFloat(2))
+	}
+	dv := &deepViewport{
+		prec: prec,
+		cx:   new(big.Float).SetPrec(prec).Set(cx),
+		cy:   new(big.Float).SetPrec(prec).Set(cy),
+		re0:  new(big.Float).SetPrec(prec).Sub(cx, half),
+		im0:  new(big.Float).SetPrec(prec).Sub(cy, halfHeight),
+		step: new(big.Float).SetPrec(prec).Set(step),
+	}
+	dv.fstep, _ = step.Float64()
+	return dv, nil
+}
+
+// point returns the coordinates of pixel (x, y) of the viewport.
+func (vp *deepViewport) point(x int, y int) (*big.Float, *big.Float) {
+	re := new(big.Float).SetPrec(vp.prec).SetInt64(int64(x))
+	re.Mul(re, vp.step).Add(re, vp.re0)
+	im := new(big.Float).SetPrec(vp.prec).SetInt64(int64(y))
+	im.Mul(im, vp.step).Add(im, vp.im0)
+	return re, im
+}
+
+// computeDeep renders a block of a deep viewport. Perturbation is used
+// unless big.Float iteration is requested, or the zoom is past the
+// exponent range of float64 deltas.
+func computeDeep(ctx context.Context, vp Viewport, p Params, bailout float64, b blockPos) (*Block, error) {
+	if p.Formula != "" && p.Formula != "mandelbrot" {
+		return nil, fmt.Errorf("formula %s does not support deep zoom", p.Formula)
+	}
+	dv, err := parseDeepViewport(vp)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.Algorithm {
+	case Float64:
+		return nil, fmt.Errorf("deep viewports cannot be rendered with float64")
+	case BigFloat:
+		return computeBigFloat(ctx, p, bailout, dv, b)
+	}
+	if dv.fstep < minPerturbationStep {
+		return computeBigFloat(ctx, p, bailout, dv, b)
+	}
+	return computePerturbation(ctx, vp.Deep, p, bailout, dv, b)
+}
+
+// computeBigFloat renders a block of a deep viewport iterating every
+// pixel with big.Float at the precision the zoom depth requires.
+func computeBigFloat(ctx context.Context, p Params, bailout float64, dv *deepViewport, b blockPos) (*Block, error) {
+	it, degree, _ := newIteration("mandelbrot", nil)
+	br := b.newBlock()
+
+	for x := 0; x < b.w; x++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for y := 0; y < b.h; y++ {
+			pr, pi := dv.point(b.pixel(x, y))
+			curIters, z, c := iterateBig(p, bailout, dv.prec, pr, pi)
+			br.Iters = append(br.Iters, curIters)
+			if p.Smooth {
+				br.Smooth = append(br.Smooth, smoothIters(it, degree, z, 0, c, curIters, int32(p.MaxIters)))
+			}
+		}
+	}
+
+	return br, nil
+}
+
+// iterateBig iterates z^2 + c for the pixel at (pr, pi) with big.Float,
+// until |z|^2 exceeds bailout. It returns the iteration count, and the
+// final z and c rounded to complex128.
+func iterateBig(p Params, bailout float64, prec uint, pr *big.Float, pi *big.Float) (int32, complex128, complex128) {
+	zr, zi := new(big.Float).SetPrec(prec), new(big.Float).SetPrec(prec)
+	zr2, zi2 := new(big.Float).SetPrec(prec), new(big.Float).SetPrec(prec)
+	cr, ci := pr, pi
+	if p.Julia {
+		zr.Set(pr)
+		zi.Set(pi)
+		cr = new(big.Float).SetPrec(prec).SetFloat64(real(p.C))
+		ci = new(big.Float).SetPrec(prec).SetFloat64(imag(p.C))
+	}
+
+	maxIters := int32(p.MaxIters)
+	curIters := maxIters
+	var fr, fi float64
+	for i := int32(1); i < maxIters; i++ {
+		zr2.Mul(zr, zr)
+		zi2.Mul(zi, zi)
+		zi.Mul(zi, zr)
+		zi.Add(zi, zi)
+		zi.Add(zi, ci)
+		zr.Sub(zr2, zi2)
+		zr.Add(zr, cr)
+
+		fr, _ = zr.Float64()
+		fi, _ = zi.Float64()
+		if fr*fr+fi*fi > bailout {
+			curIters = i
+			break
+		}
+	}
+
+	re, _ := cr.Float64()
+	im, _ := ci.Float64()
+	return curIters, complex(fr, fi), complex(re, im)
+}
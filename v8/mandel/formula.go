@@ -0,0 +1,156 @@
+package mandel
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+// iteration computes the next value of z. prev is the value of z before
+// the previous iteration, which only some formulas depend on.
+type iteration func(z complex128, prev complex128, c complex128) complex128
+
+// formula is a named escape-time iteration. build returns the iteration
+// for a set of parameters, already merged with the defaults in params,
+// together with its degree which is used to renormalise smooth counts.
+type formula struct {
+	name   string
+	params map[string]float64
+	build  func(p map[string]float64) (iteration, float64)
+}
+
+// formulas is the registry of the formulas that can be iterated.
+var formulas = map[string]*formula{}
+
+func registerFormula(f *formula) {
+	formulas[f.name] = f
+}
+
+func init() {
+	registerFormula(&formula{
+		name:   "mandelbrot",
+		params: map[string]float64{},
+		build: func(p map[string]float64) (iteration, float64) {
+			return func(z, prev, c complex128) complex128 {
+				return z*z + c
+			}, 2
+		},
+	})
+
+	registerFormula(&formula{
+		name:   "multibrot",
+		params: map[string]float64{"power": 3},
+		build: func(p map[string]float64) (iteration, float64) {
+			power := p["power"]
+			if n := int(power); float64(n) == power && n >= 2 && n <= 16 {
+				return func(z, prev, c complex128) complex128 {
+					w := z
+					for i := 1; i < n; i++ {
+						w *= z
+					}
+					return w + c
+				}, power
+			}
+			return func(z, prev, c complex128) complex128 {
+				return cmplx.Pow(z, complex(power, 0)) + c
+			}, power
+		},
+	})
+
+	registerFormula(&formula{
+		name:   "burningship",
+		params: map[string]float64{},
+		build: func(p map[string]float64) (iteration, float64) {
+			return func(z, prev, c complex128) complex128 {
+				z = complex(math.Abs(real(z)), math.Abs(imag(z)))
+				return z*z + c
+			}, 2
+		},
+	})
+
+	registerFormula(&formula{
+		name:   "tricorn",
+		params: map[string]float64{},
+		build: func(p map[string]float64) (iteration, float64) {
+			return func(z, prev, c complex128) complex128 {
+				z = cmplx.Conj(z)
+				return z*z + c
+			}, 2
+		},
+	})
+	formulas["mandelbar"] = formulas["tricorn"]
+
+	registerFormula(&formula{
+		name:   "celtic",
+		params: map[string]float64{},
+		build: func(p map[string]float64) (iteration, float64) {
+			return func(z, prev, c complex128) complex128 {
+				z = z * z
+				return complex(math.Abs(real(z)), imag(z)) + c
+			}, 2
+		},
+	})
+
+	registerFormula(&formula{
+		name:   "phoenix",
+		params: map[string]float64{"p": -0.5, "pImag": 0},
+		build: func(p map[string]float64) (iteration, float64) {
+			k := complex(p["p"], p["pImag"])
+			return func(z, prev, c complex128) complex128 {
+				return z*z + c + k*prev
+			}, 2
+		},
+	})
+}
+
+// newIteration looks up a formula and builds its iteration. An empty name
+// selects the classic Mandelbrot iteration.
+func newIteration(name string, params map[string]float64) (iteration, float64, error) {
+	if name == "" {
+		name = "mandelbrot"
+	}
+	f, ok := formulas[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown formula: %q", name)
+	}
+
+	merged := make(map[string]float64)
+	for k, v := range f.params {
+		merged[k] = v
+	}
+	for k, v := range params {
+		if _, ok := f.params[k]; !ok {
+			return nil, 0, fmt.Errorf("unknown parameter %q for formula %s, known parameters: %v", k, name, formulaParams(f))
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, 0, fmt.Errorf("invalid parameter %q for formula %s: %v", k, name, v)
+		}
+		merged[k] = v
+	}
+
+	it, degree := f.build(merged)
+	if degree <= 1 {
+		return nil, 0, fmt.Errorf("formula %s needs a degree above 1: %v", name, degree)
+	}
+	return it, degree, nil
+}
+
+func formulaParams(f *formula) []string {
+	var names []string
+	for k := range f.params {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Formulas returns the names of the formulas that can be iterated.
+func Formulas() []string {
+	var names []string
+	for name := range formulas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
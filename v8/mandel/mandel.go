@@ -0,0 +1,354 @@
+// Package mandel renders escape-time fractals. It is the kernel shared by
+// the command line renderer, the backend, which serves it over gRPC, and the
+// frontend, which runs it in-process when no backend can be reached or when
+// it runs standalone.
+//
+// A Viewport maps a region of the complex plane onto an image, Params
+// select what is iterated on it. RenderBlock renders a square block of the
+// image, Render the whole image.
+//
+// The earlier versions of the repository keep their own kernels on purpose,
+// as snapshots of their step, and do not use this package.
+package mandel
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"runtime"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultBlockSize is the size of the blocks Render splits an image
+	// into.
+	DefaultBlockSize = 32
+	// DefaultEscapeRadius is the smallest escape radius that is correct
+	// for every formula. Smooth colouring looks better with larger ones.
+	DefaultEscapeRadius = 2.0
+	// KernelVersion identifies the results of the kernel and is bumped
+	// whenever they change, so results cached by older kernels are not
+	// reused.
+	KernelVersion = 3
+)
+
+// The limits of a render. MaxSize bounds the width and height of a
+// viewport, MaxBlockSize the size of its blocks and MaxIterations
+// Params.MaxIters, as iteration counts are int32.
+const (
+	MaxSize       = 1 << 16
+	MaxBlockSize  = 1 << 10
+	MaxIterations = math.MaxInt32
+)
+
+// smoothExtraIters is the number of iterations run past the escape before
+// renormalising, which keeps the error of the smooth count small.
+const smoothExtraIters = 2
+
+// Viewport is a region of the complex plane rendered onto Width x Height
+// pixels. Pixel (0, 0) is at Start, and pixels advance towards End.
+type Viewport struct {
+	Start  complex128
+	End    complex128
+	Width  int
+	Height int
+	// Deep describes the region with arbitrary precision, for zooms too
+	// deep for float64. Start and End are ignored when it is set.
+	Deep *DeepViewport
+}
+
+// DeepViewport is a region given by its center and its width, as decimal
+// strings of any precision. Its pixels are square, its height follows from
+// the aspect ratio of the image.
+type DeepViewport struct {
+	CenterX string
+	CenterY string
+	Span    string
+}
+
+// Algorithm selects how deep viewports are rendered.
+type Algorithm int
+
+const (
+	// Auto renders deep viewports with perturbation, falling back to
+	// BigFloat past the exponent range of float64.
+	Auto Algorithm = iota
+	// Float64 rejects deep viewports.
+	Float64
+	// BigFloat iterates every pixel with big.Float.
+	BigFloat
+	// Perturbation iterates the difference of every pixel to a reference
+	// orbit in float64.
+	Perturbation
+)
+
+var algorithmNames = map[Algorithm]string{
+	Auto:         "auto",
+	Float64:      "float64",
+	BigFloat:     "bigfloat",
+	Perturbation: "perturbation",
+}
+
+func (a Algorithm) String() string {
+	if name, ok := algorithmNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Algorithm(%d)", int(a))
+}
+
+// Params select the fractal iterated on a viewport.
+type Params struct {
+	MaxIters int
+	// Formula is one of Formulas, mandelbrot when empty, and
+	// FormulaParams its parameters.
+	Formula       string
+	FormulaParams map[string]float64
+	// Julia renders the Julia set of the constant C instead of the set of
+	// the formula.
+	Julia bool
+	C     complex128
+	// Smooth also computes fractional iteration counts.
+	Smooth    bool
+	Algorithm Algorithm
+	// EscapeRadius is the modulus past which a point has escaped,
+	// DefaultEscapeRadius when 0.
+	EscapeRadius float64
+}
+
+// bailout returns the square of the escape radius of p.
+func (p Params) bailout() (float64, error) {
+	r := p.EscapeRadius
+	if r == 0 {
+		r = DefaultEscapeRadius
+	}
+	if math.IsNaN(r) || math.IsInf(r, 0) || r < DefaultEscapeRadius {
+		return 0, fmt.Errorf("escape radius must be a finite number of at least %g: %v", DefaultEscapeRadius, p.EscapeRadius)
+	}
+	return r * r, nil
+}
+
+func squaredModulus(z complex128) float64 {
+	return real(z)*real(z) + imag(z)*imag(z)
+}
+
+// Block holds the iteration counts of a block, column by column, and with
+// Params.Smooth the fractional counts in the same order. Blocks on the
+// right and bottom edges of an image are cut to it, and narrower or lower
+// than the block size.
+type Block struct {
+	Width  int
+	Height int
+	Iters  []int32
+	Smooth []float32
+}
+
+// Image holds the iteration counts of a whole viewport, row by row.
+type Image struct {
+	Width  int
+	Height int
+	Iters  []int32
+	Smooth []float32
+}
+
+// blockPos addresses a block of size x size pixels of a viewport, of which
+// w x h pixels are within the image.
+type blockPos struct {
+	size int
+	x    int
+	y    int
+	w    int
+	h    int
+}
+
+// checkSize validates the size of a viewport and of its blocks.
+func checkSize(vp Viewport, blockSize int) error {
+	if blockSize <= 0 || blockSize > MaxBlockSize {
+		return fmt.Errorf("block size out of range [1, %d]: %d", MaxBlockSize, blockSize)
+	}
+	if vp.Width <= 0 || vp.Height <= 0 || vp.Width > MaxSize || vp.Height > MaxSize {
+		return fmt.Errorf("width and height out of range [1, %d]: %dx%d", MaxSize, vp.Width, vp.Height)
+	}
+	return nil
+}
+
+// newBlockPos addresses block (x, y) of a viewport, cut to its edges.
+func newBlockPos(vp Viewport, size int, x int, y int) (blockPos, error) {
+	cols, rows := (vp.Width+size-1)/size, (vp.Height+size-1)/size
+	if x < 0 || y < 0 || x >= cols || y >= rows {
+		return blockPos{}, fmt.Errorf("block %d:%d is outside of the image", x, y)
+	}
+	x0, y0 := x*size, y*size
+	w, h := size, size
+	if x0+w > vp.Width {
+		w = vp.Width - x0
+	}
+	if y0+h > vp.Height {
+		h = vp.Height - y0
+	}
+	return blockPos{size: size, x: x, y: y, w: w, h: h}, nil
+}
+
+// pixel returns the position in the viewport of pixel (x, y) of the block.
+func (b blockPos) pixel(x int, y int) (int, int) {
+	return x + b.size*b.x, y + b.size*b.y
+}
+
+func (b blockPos) newBlock() *Block {
+	return &Block{Width: b.w, Height: b.h, Iters: make([]int32, 0, b.w*b.h)}
+}
+
+// smoothIters returns the renormalised, fractional iteration count of a
+// point that escaped after iters iterations with final values z and prev.
+func smoothIters(it iteration, degree float64, z complex128, prev complex128, c complex128, iters int32, maxIters int32) float32 {
+	if iters >= maxIters {
+		return float32(maxIters)
+	}
+	for i := 0; i < smoothExtraIters; i++ {
+		z, prev = it(z, prev, c), z
+	}
+	modulus := cmplx.Abs(z)
+	if modulus <= 1 || math.IsInf(modulus, 0) || math.IsNaN(modulus) {
+		return float32(iters)
+	}
+	return float32(float64(iters+smoothExtraIters) + 1 - math.Log(math.Log(modulus))/math.Log(degree))
+}
+
+// RenderBlock renders block (xBlock, yBlock) of blockSize x blockSize
+// pixels of a viewport. It fails for invalid viewports, params or blocks,
+// sizes past the limits of a render included, and with the error of ctx
+// once ctx is done, which is checked after every column of pixels.
+func RenderBlock(ctx context.Context, vp Viewport, p Params, blockSize int, xBlock int, yBlock int) (*Block, error) {
+	if err := checkSize(vp, blockSize); err != nil {
+		return nil, err
+	}
+	if p.MaxIters <= 0 || p.MaxIters > MaxIterations {
+		return nil, fmt.Errorf("maxIters out of range [1, %d]: %d", MaxIterations, p.MaxIters)
+	}
+	bailout, err := p.bailout()
+	if err != nil {
+		return nil, err
+	}
+	b, err := newBlockPos(vp, blockSize, xBlock, yBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	if vp.Deep != nil {
+		return computeDeep(ctx, vp, p, bailout, b)
+	}
+	if p.Algorithm == BigFloat || p.Algorithm == Perturbation {
+		return nil, fmt.Errorf("algorithm %s requires a deep viewport", p.Algorithm)
+	}
+	it, degree, err := newIteration(p.Formula, p.FormulaParams)
+	if err != nil {
+		return nil, err
+	}
+
+	maxIters := int32(p.MaxIters)
+	xStep := (real(vp.End) - real(vp.Start)) / float64(vp.Width)
+	yStep := (imag(vp.End) - imag(vp.Start)) / float64(vp.Height)
+	br := b.newBlock()
+
+	for x := 0; x < b.w; x++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for y := 0; y < b.h; y++ {
+			px, py := b.pixel(x, y)
+			c := complex(real(vp.Start)+float64(px)*xStep, imag(vp.Start)+float64(py)*yStep)
+			z := complex(0, 0)
+			if p.Julia {
+				z, c = c, p.C
+			}
+			prev := complex(0, 0)
+			curIters := maxIters
+			for i := int32(1); i < maxIters; i++ {
+				z, prev = it(z, prev, c), z
+				if squaredModulus(z) > bailout {
+					curIters = i
+					break
+				}
+			}
+			br.Iters = append(br.Iters, curIters)
+			if p.Smooth {
+				br.Smooth = append(br.Smooth, smoothIters(it, degree, z, prev, c, curIters, maxIters))
+			}
+		}
+	}
+
+	return br, nil
+}
+
+// Render renders a whole viewport, its blocks of DefaultBlockSize pixels
+// computed on every CPU at once. It stops with the error of ctx once ctx
+// is done.
+func Render(ctx context.Context, vp Viewport, p Params) (*Image, error) {
+	if err := checkSize(vp, DefaultBlockSize); err != nil {
+		return nil, err
+	}
+	n := vp.Width * vp.Height
+	img := &Image{Width: vp.Width, Height: vp.Height, Iters: make([]int32, n)}
+	if p.Smooth {
+		img.Smooth = make([]float32, n)
+	}
+
+	cols := (vp.Width + DefaultBlockSize - 1) / DefaultBlockSize
+	rows := (vp.Height + DefaultBlockSize - 1) / DefaultBlockSize
+	jobs := make(chan blockPos)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range jobs {
+				br, err := RenderBlock(ctx, vp, p, DefaultBlockSize, b.x, b.y)
+				if err != nil {
+					errOnce.Do(func() { firstErr = err })
+					continue
+				}
+				img.setBlock(b.x, b.y, br)
+			}
+		}()
+	}
+feed:
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			select {
+			case jobs <- blockPos{x: x, y: y}:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// setBlock copies block (xBlock, yBlock) of DefaultBlockSize pixels into
+// the image.
+func (img *Image) setBlock(xBlock int, yBlock int, br *Block) {
+	for x := 0; x < br.Width; x++ {
+		for y := 0; y < br.Height; y++ {
+			src := x*br.Height + y
+			dst := (y+DefaultBlockSize*yBlock)*img.Width + x + DefaultBlockSize*xBlock
+			img.Iters[dst] = br.Iters[src]
+			if img.Smooth != nil && br.Smooth != nil {
+				img.Smooth[dst] = br.Smooth[src]
+			}
+		}
+	}
+}
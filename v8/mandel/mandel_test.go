@@ -0,0 +1,263 @@
+package mandel
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// point returns a viewport of a single pixel at c.
+func point(c complex128) Viewport {
+	return Viewport{Start: c, End: c + (1 + 1i), Width: 1, Height: 1}
+}
+
+func TestRenderBlockEscape(t *testing.T) {
+	tests := []struct {
+		name   string
+		c      complex128
+		p      Params
+		iters  int32
+		smooth bool
+	}{
+		{"origin", 0, Params{MaxIters: 100}, 100, false},
+		{"period 2", -1, Params{MaxIters: 100}, 100, false},
+		{"tip", -2, Params{MaxIters: 100}, 100, false},
+		{"cusp", 0.25, Params{MaxIters: 100}, 100, false},
+		{"outside at once", 3, Params{MaxIters: 100}, 1, false},
+		// |z|² reaches 4 without exceeding it, then escapes.
+		{"on the radius", 1, Params{MaxIters: 100}, 3, false},
+		// Escapes on |z|², where real(z)+imag(z) never exceeds 4.
+		{"imaginary axis", 1.5i, Params{MaxIters: 100}, 2, false},
+		{"escape radius", 1, Params{MaxIters: 100, EscapeRadius: 10}, 4, false},
+		{"maxIters", 0.3 + 0.5i, Params{MaxIters: 10}, 10, false},
+		{"smooth", 1.5i, Params{MaxIters: 100, Smooth: true}, 2, true},
+		{"julia inside", 0.5, Params{MaxIters: 100, Julia: true}, 100, false},
+		{"julia outside", 1.5, Params{MaxIters: 100, Julia: true}, 1, false},
+		{"julia constant", 0, Params{MaxIters: 100, Julia: true, C: 3}, 1, false},
+		{"burning ship", -1, Params{MaxIters: 100, Formula: "burningship"}, 100, false},
+		{"multibrot", 1, Params{MaxIters: 100, Formula: "multibrot"}, 3, false},
+		// Points of the Mandelbrot set outside of the other sets, and the
+		// other way around.
+		{"tricorn", -0.1 + 0.8i, Params{MaxIters: 100, Formula: "tricorn"}, 3, false},
+		{"mandelbar", -0.5 + 0.5i, Params{MaxIters: 100, Formula: "mandelbar"}, 4, false},
+		{"tricorn inside", 0.3 + 0.5i, Params{MaxIters: 100, Formula: "tricorn"}, 100, false},
+		{"celtic", 0.3 + 0.5i, Params{MaxIters: 100, Formula: "celtic"}, 4, false},
+		{"celtic inside", -1.75, Params{MaxIters: 100, Formula: "celtic"}, 100, false},
+		{"phoenix", -1.75, Params{MaxIters: 100, Formula: "phoenix"}, 8, false},
+		{"phoenix inside", 0.4, Params{MaxIters: 100, Formula: "phoenix"}, 100, false},
+		{"phoenix p", -1.3, Params{MaxIters: 100, Formula: "phoenix", FormulaParams: map[string]float64{"p": 0.5}}, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := RenderBlock(context.Background(), point(tt.c), tt.p, DefaultBlockSize, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.Width != 1 || b.Height != 1 || len(b.Iters) != 1 {
+				t.Fatalf("block of %dx%d with %d counts, want a single pixel", b.Width, b.Height, len(b.Iters))
+			}
+			if b.Iters[0] != tt.iters {
+				t.Errorf("iters = %d, want %d", b.Iters[0], tt.iters)
+			}
+			if !tt.smooth {
+				if b.Smooth != nil {
+					t.Errorf("smooth counts without Params.Smooth")
+				}
+				return
+			}
+			if len(b.Smooth) != 1 || math.Abs(float64(b.Smooth[0])-float64(tt.iters)) > smoothExtraIters+1 {
+				t.Errorf("smooth = %v, want close to %d", b.Smooth, tt.iters)
+			}
+		})
+	}
+}
+
+// Blocks on the right and bottom edges are cut to the image, and blocks
+// agree with the image rendered as a whole.
+func TestRenderBlockEdges(t *testing.T) {
+	vp := Viewport{Start: -2 - 1.2i, End: 0.6 + 1.2i, Width: 70, Height: 45}
+	p := Params{MaxIters: 64, Smooth: true}
+	img, err := Render(context.Background(), vp, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		x, y int
+		w, h int
+	}{
+		{0, 0, 32, 32},
+		{1, 0, 32, 32},
+		{2, 0, 6, 32},
+		{0, 1, 32, 13},
+		{2, 1, 6, 13},
+	}
+	for _, tt := range tests {
+		b, err := RenderBlock(context.Background(), vp, p, DefaultBlockSize, tt.x, tt.y)
+		if err != nil {
+			t.Fatalf("block %d:%d: %s", tt.x, tt.y, err)
+		}
+		if b.Width != tt.w || b.Height != tt.h || len(b.Iters) != tt.w*tt.h || len(b.Smooth) != tt.w*tt.h {
+			t.Errorf("block %d:%d: %dx%d with %d counts, want %dx%d", tt.x, tt.y, b.Width, b.Height, len(b.Iters), tt.w, tt.h)
+			continue
+		}
+		for x := 0; x < b.Width; x++ {
+			for y := 0; y < b.Height; y++ {
+				n := (tt.y*DefaultBlockSize+y)*img.Width + tt.x*DefaultBlockSize + x
+				if b.Iters[x*b.Height+y] != img.Iters[n] || b.Smooth[x*b.Height+y] != img.Smooth[n] {
+					t.Fatalf("block %d:%d pixel %d,%d differs from the image", tt.x, tt.y, x, y)
+				}
+			}
+		}
+	}
+
+	for _, xy := range [][2]int{{3, 0}, {0, 2}, {-1, 0}, {0, -1}} {
+		if _, err := RenderBlock(context.Background(), vp, p, DefaultBlockSize, xy[0], xy[1]); err == nil {
+			t.Errorf("block %d:%d outside of the image rendered", xy[0], xy[1])
+		}
+	}
+}
+
+func TestRenderBlockErrors(t *testing.T) {
+	vp := Viewport{Start: -2 - 1.5i, End: 0.6 + 1.5i, Width: 64, Height: 64}
+	p := Params{MaxIters: 100}
+	tests := []struct {
+		name      string
+		vp        Viewport
+		p         Params
+		blockSize int
+	}{
+		{"block size", vp, p, 0},
+		{"large block size", Viewport{Width: 50000, Height: 50000}, Params{MaxIters: 1}, 50000},
+		{"width", Viewport{Width: 0, Height: 64}, p, 32},
+		{"height", Viewport{Width: 64, Height: -1}, p, 32},
+		{"large width", Viewport{Width: MaxSize + 1, Height: 64}, p, 32},
+		{"large height", Viewport{Width: 64, Height: 1 << 40}, p, 32},
+		{"maxIters", vp, Params{}, 32},
+		{"large maxIters", vp, Params{MaxIters: MaxIterations + 1}, 32},
+		{"unknown formula", vp, Params{MaxIters: 100, Formula: "nope"}, 32},
+		{"unknown formula parameter", vp, Params{MaxIters: 100, Formula: "multibrot", FormulaParams: map[string]float64{"nope": 1}}, 32},
+		{"escape radius", vp, Params{MaxIters: 100, EscapeRadius: 1}, 32},
+		{"algorithm without deep viewport", vp, Params{MaxIters: 100, Algorithm: BigFloat}, 32},
+		{"deep float64", Viewport{Width: 8, Height: 8, Deep: &DeepViewport{"0", "0", "1e-20"}}, Params{MaxIters: 100, Algorithm: Float64}, 32},
+		{"deep formula", Viewport{Width: 8, Height: 8, Deep: &DeepViewport{"0", "0", "1e-20"}}, Params{MaxIters: 100, Formula: "burningship"}, 32},
+		{"deep center", Viewport{Width: 8, Height: 8, Deep: &DeepViewport{"x", "0", "1e-20"}}, p, 32},
+	}
+	for _, tt := range tests {
+		if _, err := RenderBlock(context.Background(), tt.vp, tt.p, tt.blockSize, 0, 0); err == nil {
+			t.Errorf("%s: RenderBlock succeeded", tt.name)
+		}
+	}
+	if _, err := Render(context.Background(), vp, Params{MaxIters: 100, Formula: "nope"}); err == nil {
+		t.Errorf("Render of an unknown formula succeeded")
+	}
+	if _, err := Render(context.Background(), Viewport{Width: MaxSize + 1, Height: 1}, p); err == nil {
+		t.Errorf("Render of an image wider than MaxSize succeeded")
+	}
+}
+
+// The largest blocks of the largest viewports render.
+func TestRenderBlockLimits(t *testing.T) {
+	vp := Viewport{Start: -2 - 2i, End: 2 + 2i, Width: MaxSize, Height: MaxSize}
+	last := MaxSize/MaxBlockSize - 1
+	b, err := RenderBlock(context.Background(), vp, Params{MaxIters: 1}, MaxBlockSize, last, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Width != MaxBlockSize || b.Height != MaxBlockSize || len(b.Iters) != MaxBlockSize*MaxBlockSize {
+		t.Errorf("block of %dx%d with %d counts", b.Width, b.Height, len(b.Iters))
+	}
+	if _, err := RenderBlock(context.Background(), vp, Params{MaxIters: 1}, MaxBlockSize, last+1, 0); err == nil {
+		t.Errorf("block past the last one rendered")
+	}
+}
+
+func TestRenderCanceled(t *testing.T) {
+	vp := Viewport{Start: -2 - 1.5i, End: 0.6 + 1.5i, Width: 256, Height: 256}
+	p := Params{MaxIters: 100}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := RenderBlock(ctx, vp, p, DefaultBlockSize, 0, 0); err != context.Canceled {
+		t.Errorf("RenderBlock with a canceled context: %v", err)
+	}
+	if _, err := Render(ctx, vp, p); err != context.Canceled {
+		t.Errorf("Render with a canceled context: %v", err)
+	}
+
+	// A render inside the set takes far longer than the deadline.
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := Render(ctx, Viewport{Start: -0.1 - 0.1i, End: 0.1 + 0.1i, Width: 2048, Height: 2048}, Params{MaxIters: 1 << 20})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Render past its deadline: %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Render stopped %s after its deadline", d)
+	}
+}
+
+// Perturbation agrees with iterating every pixel with big.Float, up to the
+// rare pixels on which rounding decides the escape.
+func TestPerturbationMatchesBigFloat(t *testing.T) {
+	tests := []struct {
+		name string
+		vp   Viewport
+		p    Params
+	}{
+		// Misiurewicz points show detail at every scale.
+		{"dendrite", Viewport{Width: 24, Height: 16, Deep: &DeepViewport{
+			CenterX: "0.0000000000000000000003",
+			CenterY: "1",
+			Span:    "1e-20",
+		}}, Params{MaxIters: 800, Smooth: true}},
+		{"tip", Viewport{Width: 16, Height: 16, Deep: &DeepViewport{
+			CenterX: "-2",
+			CenterY: "0",
+			Span:    "1e-25",
+		}}, Params{MaxIters: 500}},
+		{"julia", Viewport{Width: 16, Height: 16, Deep: &DeepViewport{
+			CenterX: "0",
+			CenterY: "1.0000000000000000000001",
+			Span:    "1e-18",
+		}}, Params{MaxIters: 300, Julia: true, C: 1i}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pp, bp := tt.p, tt.p
+			pp.Algorithm, bp.Algorithm = Perturbation, BigFloat
+			want, err := Render(context.Background(), tt.vp, bp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Render(context.Background(), tt.vp, pp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lo, hi := want.Iters[0], want.Iters[0]
+			for _, it := range want.Iters {
+				if it < lo {
+					lo = it
+				}
+				if it > hi {
+					hi = it
+				}
+			}
+			if hi-lo < 10 {
+				t.Fatalf("iteration counts %d to %d: the view shows no detail", lo, hi)
+			}
+			differ := 0
+			for n := range want.Iters {
+				d := got.Iters[n] - want.Iters[n]
+				if d < -1 || d > 1 {
+					differ++
+				}
+			}
+			if differ > len(want.Iters)/100 {
+				t.Errorf("%d of %d pixels differ by more than one iteration", differ, len(want.Iters))
+			}
+		})
+	}
+}
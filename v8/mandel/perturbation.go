@@ -0,0 +1,192 @@
+package mandel
+
+import (
+	"math"
+	"math/big"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// orbitCacheSize is the number of reference orbits kept, so blocks of
+	// the same frame share a single high precision orbit.
+	orbitCacheSize int = 16
+	// minPerturbationStep is the smallest pixel step whose deltas still
+	// fit in the exponent range of float64.
+	minPerturbationStep float64 = 1e-290
+	// glitchTolerance flags pixels whose value got too close to the
+	// reference orbit to be represented by its float64 delta.
+	glitchTolerance float64 = 1e-6
+)
+
+// orbitKey identifies a reference orbit. For Julia sets c is the constant
+// of the iteration.
+type orbitKey struct {
+	cx       string
+	cy       string
+	prec     uint
+	maxIters int32
+	bailout  float64
+	julia    bool
+	c        complex128
+}
+
+type orbitEntry struct {
+	once  sync.Once
+	orbit []complex128
+}
+
+// orbitCache holds the most recently used reference orbits.
+type orbitCache struct {
+	mux     sync.Mutex
+	entries map[orbitKey]*orbitEntry
+	order   []orbitKey
+}
+
+var orbits = &orbitCache{entries: make(map[orbitKey]*orbitEntry)}
+
+// get returns the orbit of key, computing it with compute on a miss.
+// Concurrent requests for the same orbit wait for a single computation.
+func (oc *orbitCache) get(key orbitKey, compute func() []complex128) []complex128 {
+	oc.mux.Lock()
+	e, ok := oc.entries[key]
+	if !ok {
+		e = &orbitEntry{}
+		oc.entries[key] = e
+		oc.order = append(oc.order, key)
+		if len(oc.order) > orbitCacheSize {
+			delete(oc.entries, oc.order[0])
+			oc.order = oc.order[1:]
+		}
+	}
+	oc.mux.Unlock()
+
+	e.once.Do(func() {
+		e.orbit = compute()
+	})
+	return e.orbit
+}
+
+// referenceOrbit iterates z^2 + c at full precision from (zr, zi) and
+// returns the orbit rounded to complex128. The orbit stops early when the
+// reference escapes past bailout, pixels then rebase onto its start.
+func referenceOrbit(prec uint, zr, zi, cr, ci *big.Float, maxIters int32, bailout float64) []complex128 {
+	zr = new(big.Float).SetPrec(prec).Set(zr)
+	zi = new(big.Float).SetPrec(prec).Set(zi)
+	zr2, zi2 := new(big.Float).SetPrec(prec), new(big.Float).SetPrec(prec)
+
+	orbit := make([]complex128, 0, maxIters+1)
+	for i := int32(0); i <= maxIters; i++ {
+		fr, _ := zr.Float64()
+		fi, _ := zi.Float64()
+		orbit = append(orbit, complex(fr, fi))
+		if fr*fr+fi*fi > bailout {
+			break
+		}
+
+		zr2.Mul(zr, zr)
+		zi2.Mul(zi, zi)
+		zi.Mul(zi, zr)
+		zi.Add(zi, zi)
+		zi.Add(zi, ci)
+		zr.Sub(zr2, zi2)
+		zr.Add(zr, cr)
+	}
+	return orbit
+}
+
+// computePerturbation renders a block of a deep viewport by iterating, in
+// float64, the difference of every pixel to a high precision reference
+// orbit at the center of the viewport. When a pixel gets closer to zero
+// than its delta, or close enough to the reference to lose the precision
+// of its delta, it is rebased onto the start of the reference orbit.
+// Pixels whose delta stops being finite are rendered with big.Float.
+func computePerturbation(ctx context.Context, deep *DeepViewport, p Params, bailout float64, dv *deepViewport, b blockPos) (*Block, error) {
+	maxIters := int32(p.MaxIters)
+	key := orbitKey{
+		cx:       deep.CenterX,
+		cy:       deep.CenterY,
+		prec:     dv.prec,
+		maxIters: maxIters,
+		bailout:  bailout,
+		julia:    p.Julia,
+	}
+
+	zero := new(big.Float).SetPrec(dv.prec)
+	var orbit []complex128
+	if p.Julia {
+		key.c = p.C
+		cr := new(big.Float).SetPrec(dv.prec).SetFloat64(real(p.C))
+		ci := new(big.Float).SetPrec(dv.prec).SetFloat64(imag(p.C))
+		orbit = orbits.get(key, func() []complex128 {
+			return referenceOrbit(dv.prec, dv.cx, dv.cy, cr, ci, maxIters, bailout)
+		})
+	} else {
+		orbit = orbits.get(key, func() []complex128 {
+			return referenceOrbit(dv.prec, zero, zero, dv.cx, dv.cy, maxIters, bailout)
+		})
+	}
+
+	last := len(orbit) - 1
+	if last == 0 {
+		return computeBigFloat(ctx, p, bailout, dv, b)
+	}
+
+	it, degree, _ := newIteration("mandelbrot", nil)
+	br := b.newBlock()
+	dr, di := new(big.Float).SetPrec(dv.prec), new(big.Float).SetPrec(dv.prec)
+	cxf, _ := dv.cx.Float64()
+	cyf, _ := dv.cy.Float64()
+
+	for x := 0; x < b.w; x++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for y := 0; y < b.h; y++ {
+			pr, pi := dv.point(b.pixel(x, y))
+			fr, _ := dr.Sub(pr, dv.cx).Float64()
+			fi, _ := di.Sub(pi, dv.cy).Float64()
+			delta := complex(fr, fi)
+
+			// For the Mandelbrot set the pixel perturbs c, for Julia
+			// sets it perturbs the starting value of z.
+			dc, dz := delta, complex(0, 0)
+			c := complex(cxf, cyf) + delta
+			if p.Julia {
+				dc, dz = 0, delta
+				c = key.c
+			}
+
+			curIters := maxIters
+			z := orbit[0] + dz
+			m := 0
+			for i := int32(1); i < maxIters; i++ {
+				dz = 2*orbit[m]*dz + dz*dz + dc
+				m++
+				z = orbit[m] + dz
+				if squaredModulus(z) > bailout {
+					curIters = i
+					break
+				}
+				if squaredModulus(z) < squaredModulus(dz) ||
+					squaredModulus(z) < glitchTolerance*squaredModulus(orbit[m]) ||
+					m == last {
+					dz = z - orbit[0]
+					m = 0
+				}
+			}
+
+			if math.IsNaN(real(z)) || math.IsNaN(imag(z)) {
+				curIters, z, c = iterateBig(p, bailout, dv.prec, pr, pi)
+			}
+
+			br.Iters = append(br.Iters, curIters)
+			if p.Smooth {
+				br.Smooth = append(br.Smooth, smoothIters(it, degree, z, 0, c, curIters, maxIters))
+			}
+		}
+	}
+
+	return br, nil
+}
@@ -0,0 +1,150 @@
+// Package packed encodes the iteration counts of blocks compactly, as
+// little endian integers of the smallest width that holds them, optionally
+// compressed. Backends pack the results of replies with it, the frontend
+// unpacks them and stores its cached blocks in the same widths.
+package packed
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxPackedSize bounds the size of decompressed results, so a corrupt or
+// hostile reply cannot exhaust the memory of the frontend.
+const maxPackedSize = 16 << 20
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxPackedSize))
+)
+
+// BitDepth returns the smallest width, 8, 16 or 32 bits, that holds
+// iteration counts up to maxIters.
+func BitDepth(maxIters int32) int32 {
+	switch {
+	case maxIters <= 0xff:
+		return 8
+	case maxIters <= 0xffff:
+		return 16
+	}
+	return 32
+}
+
+// Pack encodes iteration counts as little endian integers of
+// bitDepth bits, compressed with c. Counts are clamped to the bit depth.
+func Pack(results []int32, bitDepth int32, c pb.Compression) ([]byte, error) {
+	if bitDepth != 8 && bitDepth != 16 && bitDepth != 32 {
+		return nil, fmt.Errorf("unsupported bit depth: %d", bitDepth)
+	}
+	size := int(bitDepth / 8)
+	limit := int64(1)<<uint(bitDepth) - 1
+
+	raw := make([]byte, len(results)*size)
+	for n, r := range results {
+		v := int64(r)
+		if v < 0 {
+			v = 0
+		}
+		if v > limit {
+			v = limit
+		}
+		switch size {
+		case 1:
+			raw[n] = byte(v)
+		case 2:
+			binary.LittleEndian.PutUint16(raw[2*n:], uint16(v))
+		case 4:
+			binary.LittleEndian.PutUint32(raw[4*n:], uint32(v))
+		}
+	}
+
+	return Compress(raw, c)
+}
+
+// Unpack returns the iteration counts of a reply in either
+// encoding, so replies of backends that ignore the requested encoding
+// are still understood.
+func Unpack(r *pb.BlockReply) ([]int32, error) {
+	if len(r.Packed) == 0 {
+		return r.Results, nil
+	}
+
+	raw, err := Decompress(r.Packed, r.Compression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid packed results: %v", err)
+	}
+
+	if r.BitDepth != 8 && r.BitDepth != 16 && r.BitDepth != 32 {
+		return nil, fmt.Errorf("unsupported bit depth: %d", r.BitDepth)
+	}
+	size := int(r.BitDepth / 8)
+	if len(raw)%size != 0 {
+		return nil, fmt.Errorf("packed results truncated: %d bytes at %d bits", len(raw), r.BitDepth)
+	}
+
+	results := make([]int32, len(raw)/size)
+	for n := range results {
+		switch size {
+		case 1:
+			results[n] = int32(raw[n])
+		case 2:
+			results[n] = int32(binary.LittleEndian.Uint16(raw[2*n:]))
+		case 4:
+			results[n] = int32(binary.LittleEndian.Uint32(raw[4*n:]))
+		}
+	}
+	return results, nil
+}
+
+// Compress compresses data with c.
+func Compress(data []byte, c pb.Compression) ([]byte, error) {
+	switch c {
+	case pb.Compression_NONE:
+		return data, nil
+	case pb.Compression_DEFLATE:
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case pb.Compression_ZSTD:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", c)
+}
+
+// Decompress reverses Compress, refusing data that decompresses to more
+// than maxPackedSize bytes.
+func Decompress(data []byte, c pb.Compression) ([]byte, error) {
+	switch c {
+	case pb.Compression_NONE:
+		return data, nil
+	case pb.Compression_DEFLATE:
+		fr := flate.NewReader(bytes.NewReader(data))
+		defer fr.Close()
+		raw, err := io.ReadAll(io.LimitReader(fr, maxPackedSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) > maxPackedSize {
+			return nil, fmt.Errorf("decompressed data larger than %d bytes", maxPackedSize)
+		}
+		return raw, nil
+	case pb.Compression_ZSTD:
+		return zstdDecoder.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", c)
+}
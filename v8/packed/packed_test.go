@@ -0,0 +1,110 @@
+package packed
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	pb "github.com/hasiotis/mandelbrot/v8/rpc"
+)
+
+var compressions = []pb.Compression{pb.Compression_NONE, pb.Compression_DEFLATE, pb.Compression_ZSTD}
+
+func TestBitDepth(t *testing.T) {
+	for _, tc := range []struct {
+		maxIters int32
+		want     int32
+	}{{1, 8}, {255, 8}, {256, 16}, {65535, 16}, {65536, 32}, {1<<31 - 1, 32}} {
+		if got := BitDepth(tc.maxIters); got != tc.want {
+			t.Errorf("BitDepth(%d) = %d, want %d", tc.maxIters, got, tc.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, maxIters := range []int32{255, 65535, 1<<31 - 1} {
+		results := make([]int32, 32*32)
+		for n := range results {
+			results[n] = int32(int64(n) * int64(maxIters) / int64(len(results)-1))
+		}
+		bitDepth := BitDepth(maxIters)
+
+		for _, c := range compressions {
+			data, err := Pack(results, bitDepth, c)
+			if err != nil {
+				t.Fatalf("Pack %d bits %s: %s", bitDepth, c, err)
+			}
+			if c == pb.Compression_NONE && len(data) != len(results)*int(bitDepth/8) {
+				t.Errorf("Pack %d bits: %d bytes, want %d", bitDepth, len(data), len(results)*int(bitDepth/8))
+			}
+			got, err := Unpack(&pb.BlockReply{Packed: data, Compression: c, BitDepth: bitDepth})
+			if err != nil {
+				t.Fatalf("Unpack %d bits %s: %s", bitDepth, c, err)
+			}
+			if !reflect.DeepEqual(got, results) {
+				t.Errorf("Unpack %d bits %s: results differ", bitDepth, c)
+			}
+		}
+	}
+}
+
+// Counts outside the range of the bit depth are clamped to it.
+func TestPackClamps(t *testing.T) {
+	for _, tc := range []struct {
+		bitDepth int32
+		want     []int32
+	}{{8, []int32{0, 255, 255}}, {16, []int32{0, 300, 65535}}, {32, []int32{0, 300, 70000}}} {
+		data, err := Pack([]int32{-5, 300, 70000}, tc.bitDepth, pb.Compression_NONE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Unpack(&pb.BlockReply{Packed: data, BitDepth: tc.bitDepth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%d bits: %v, want %v", tc.bitDepth, got, tc.want)
+		}
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	if _, err := Pack([]int32{1}, 12, pb.Compression_NONE); err == nil {
+		t.Errorf("Pack at 12 bits succeeded")
+	}
+
+	results := []int32{1, 2, 3}
+	if got, err := Unpack(&pb.BlockReply{Results: results}); err != nil || !reflect.DeepEqual(got, results) {
+		t.Errorf("Unpack of plain results = %v %v, want %v", got, err, results)
+	}
+
+	big, err := Compress(make([]byte, maxPackedSize+1), pb.Compression_DEFLATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, r := range map[string]*pb.BlockReply{
+		"bit depth":  {Packed: []byte{1, 2}, BitDepth: 12},
+		"truncated":  {Packed: []byte{1, 2, 3}, BitDepth: 16},
+		"corrupt":    {Packed: []byte{1, 2, 3}, BitDepth: 8, Compression: pb.Compression_ZSTD},
+		"oversized":  {Packed: big, BitDepth: 8, Compression: pb.Compression_DEFLATE},
+		"compressor": {Packed: []byte{1}, BitDepth: 8, Compression: pb.Compression(99)},
+	} {
+		if _, err := Unpack(r); err == nil {
+			t.Errorf("Unpack of %s results succeeded", name)
+		}
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("mandelbrot"), 1000)
+	for _, c := range compressions {
+		compressed, err := Compress(data, c)
+		if err != nil {
+			t.Fatalf("Compress %s: %s", c, err)
+		}
+		got, err := Decompress(compressed, c)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Decompress %s: %d bytes %v, want the data compressed", c, len(got), err)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package rpc
+
+// Size returns the width and height of the image of a request. Requests
+// of older frontends only carry points, the size of square images.
+func (m *BlockRequest) Size() (int32, int32) {
+	width, height := m.GetWidth(), m.GetHeight()
+	if width == 0 && height == 0 {
+		return m.GetPoints(), m.GetPoints()
+	}
+	return width, height
+}
@@ -9,8 +9,11 @@ It is generated from these files:
 
 It has these top-level messages:
 	ComplexPoint
+	DeepViewport
 	BlockRequest
 	BlockReply
+	BlockIndex
+	FrameRequest
 	HealthCheckRequest
 	HealthCheckResponse
 */
@@ -36,6 +39,104 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+type FractalKind int32
+
+const (
+	FractalKind_MANDELBROT FractalKind = 0
+	FractalKind_JULIA      FractalKind = 1
+)
+
+var FractalKind_name = map[int32]string{
+	0: "MANDELBROT",
+	1: "JULIA",
+}
+var FractalKind_value = map[string]int32{
+	"MANDELBROT": 0,
+	"JULIA":      1,
+}
+
+func (x FractalKind) String() string {
+	return proto.EnumName(FractalKind_name, int32(x))
+}
+func (FractalKind) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+// Algorithm selects how the backend iterates. AUTO uses float64 and
+// switches to perturbation for deep viewports.
+type Algorithm int32
+
+const (
+	Algorithm_AUTO         Algorithm = 0
+	Algorithm_FLOAT64      Algorithm = 1
+	Algorithm_BIGFLOAT     Algorithm = 2
+	Algorithm_PERTURBATION Algorithm = 3
+)
+
+var Algorithm_name = map[int32]string{
+	0: "AUTO",
+	1: "FLOAT64",
+	2: "BIGFLOAT",
+	3: "PERTURBATION",
+}
+var Algorithm_value = map[string]int32{
+	"AUTO":         0,
+	"FLOAT64":      1,
+	"BIGFLOAT":     2,
+	"PERTURBATION": 3,
+}
+
+func (x Algorithm) String() string {
+	return proto.EnumName(Algorithm_name, int32(x))
+}
+func (Algorithm) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+// Encoding selects how BlockReply carries the iteration counts. REPEATED
+// uses results, PACKED little endian integers of bitDepth bits in packed.
+type Encoding int32
+
+const (
+	Encoding_REPEATED Encoding = 0
+	Encoding_PACKED   Encoding = 1
+)
+
+var Encoding_name = map[int32]string{
+	0: "REPEATED",
+	1: "PACKED",
+}
+var Encoding_value = map[string]int32{
+	"REPEATED": 0,
+	"PACKED":   1,
+}
+
+func (x Encoding) String() string {
+	return proto.EnumName(Encoding_name, int32(x))
+}
+func (Encoding) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+// Compression is applied to packed results.
+type Compression int32
+
+const (
+	Compression_NONE    Compression = 0
+	Compression_DEFLATE Compression = 1
+	Compression_ZSTD    Compression = 2
+)
+
+var Compression_name = map[int32]string{
+	0: "NONE",
+	1: "DEFLATE",
+	2: "ZSTD",
+}
+var Compression_value = map[string]int32{
+	"NONE":    0,
+	"DEFLATE": 1,
+	"ZSTD":    2,
+}
+
+func (x Compression) String() string {
+	return proto.EnumName(Compression_name, int32(x))
+}
+func (Compression) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
 type HealthCheckResponse_ServingStatus int32
 
 const (
@@ -59,7 +160,7 @@ func (x HealthCheckResponse_ServingStatus) String() string {
 	return proto.EnumName(HealthCheckResponse_ServingStatus_name, int32(x))
 }
 func (HealthCheckResponse_ServingStatus) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor0, []int{4, 0}
+	return fileDescriptor0, []int{7, 0}
 }
 
 type ComplexPoint struct {
@@ -86,20 +187,66 @@ func (m *ComplexPoint) GetY() float64 {
 	return 0
 }
 
+// DeepViewport describes a region as decimal strings, for zooms past the
+// precision of double.
+type DeepViewport struct {
+	CenterX string `protobuf:"bytes,1,opt,name=centerX" json:"centerX,omitempty"`
+	CenterY string `protobuf:"bytes,2,opt,name=centerY" json:"centerY,omitempty"`
+	Span    string `protobuf:"bytes,3,opt,name=span" json:"span,omitempty"`
+}
+
+func (m *DeepViewport) Reset()                    { *m = DeepViewport{} }
+func (m *DeepViewport) String() string            { return proto.CompactTextString(m) }
+func (*DeepViewport) ProtoMessage()               {}
+func (*DeepViewport) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *DeepViewport) GetCenterX() string {
+	if m != nil {
+		return m.CenterX
+	}
+	return ""
+}
+
+func (m *DeepViewport) GetCenterY() string {
+	if m != nil {
+		return m.CenterY
+	}
+	return ""
+}
+
+func (m *DeepViewport) GetSpan() string {
+	if m != nil {
+		return m.Span
+	}
+	return ""
+}
+
 type BlockRequest struct {
-	PStart    *ComplexPoint `protobuf:"bytes,1,opt,name=pStart" json:"pStart,omitempty"`
-	PEnd      *ComplexPoint `protobuf:"bytes,2,opt,name=pEnd" json:"pEnd,omitempty"`
-	Points    int32         `protobuf:"varint,3,opt,name=points" json:"points,omitempty"`
-	MaxIters  int32         `protobuf:"varint,4,opt,name=maxIters" json:"maxIters,omitempty"`
-	BlockSize int32         `protobuf:"varint,5,opt,name=blockSize" json:"blockSize,omitempty"`
-	XBlock    int32         `protobuf:"varint,6,opt,name=xBlock" json:"xBlock,omitempty"`
-	YBlock    int32         `protobuf:"varint,7,opt,name=yBlock" json:"yBlock,omitempty"`
+	PStart        *ComplexPoint      `protobuf:"bytes,1,opt,name=pStart" json:"pStart,omitempty"`
+	PEnd          *ComplexPoint      `protobuf:"bytes,2,opt,name=pEnd" json:"pEnd,omitempty"`
+	Points        int32              `protobuf:"varint,3,opt,name=points" json:"points,omitempty"`
+	MaxIters      int32              `protobuf:"varint,4,opt,name=maxIters" json:"maxIters,omitempty"`
+	BlockSize     int32              `protobuf:"varint,5,opt,name=blockSize" json:"blockSize,omitempty"`
+	XBlock        int32              `protobuf:"varint,6,opt,name=xBlock" json:"xBlock,omitempty"`
+	YBlock        int32              `protobuf:"varint,7,opt,name=yBlock" json:"yBlock,omitempty"`
+	Smooth        bool               `protobuf:"varint,8,opt,name=smooth" json:"smooth,omitempty"`
+	Kind          FractalKind        `protobuf:"varint,9,opt,name=kind,enum=rpc.FractalKind" json:"kind,omitempty"`
+	C             *ComplexPoint      `protobuf:"bytes,10,opt,name=c" json:"c,omitempty"`
+	Formula       string             `protobuf:"bytes,11,opt,name=formula" json:"formula,omitempty"`
+	FormulaParams map[string]float64 `protobuf:"bytes,12,rep,name=formulaParams" json:"formulaParams,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	Deep          *DeepViewport      `protobuf:"bytes,13,opt,name=deep" json:"deep,omitempty"`
+	Algorithm     Algorithm          `protobuf:"varint,14,opt,name=algorithm,enum=rpc.Algorithm" json:"algorithm,omitempty"`
+	Encoding      Encoding           `protobuf:"varint,15,opt,name=encoding,enum=rpc.Encoding" json:"encoding,omitempty"`
+	Compression   Compression        `protobuf:"varint,16,opt,name=compression,enum=rpc.Compression" json:"compression,omitempty"`
+	EscapeRadius  float64            `protobuf:"fixed64,17,opt,name=escapeRadius" json:"escapeRadius,omitempty"`
+	Width         int32              `protobuf:"varint,18,opt,name=width" json:"width,omitempty"`
+	Height        int32              `protobuf:"varint,19,opt,name=height" json:"height,omitempty"`
 }
 
 func (m *BlockRequest) Reset()                    { *m = BlockRequest{} }
 func (m *BlockRequest) String() string            { return proto.CompactTextString(m) }
 func (*BlockRequest) ProtoMessage()               {}
-func (*BlockRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+func (*BlockRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
 
 func (m *BlockRequest) GetPStart() *ComplexPoint {
 	if m != nil {
@@ -150,14 +297,105 @@ func (m *BlockRequest) GetYBlock() int32 {
 	return 0
 }
 
+func (m *BlockRequest) GetSmooth() bool {
+	if m != nil {
+		return m.Smooth
+	}
+	return false
+}
+
+func (m *BlockRequest) GetKind() FractalKind {
+	if m != nil {
+		return m.Kind
+	}
+	return FractalKind_MANDELBROT
+}
+
+func (m *BlockRequest) GetC() *ComplexPoint {
+	if m != nil {
+		return m.C
+	}
+	return nil
+}
+
+func (m *BlockRequest) GetFormula() string {
+	if m != nil {
+		return m.Formula
+	}
+	return ""
+}
+
+func (m *BlockRequest) GetFormulaParams() map[string]float64 {
+	if m != nil {
+		return m.FormulaParams
+	}
+	return nil
+}
+
+func (m *BlockRequest) GetDeep() *DeepViewport {
+	if m != nil {
+		return m.Deep
+	}
+	return nil
+}
+
+func (m *BlockRequest) GetAlgorithm() Algorithm {
+	if m != nil {
+		return m.Algorithm
+	}
+	return Algorithm_AUTO
+}
+
+func (m *BlockRequest) GetEncoding() Encoding {
+	if m != nil {
+		return m.Encoding
+	}
+	return Encoding_REPEATED
+}
+
+func (m *BlockRequest) GetCompression() Compression {
+	if m != nil {
+		return m.Compression
+	}
+	return Compression_NONE
+}
+
+func (m *BlockRequest) GetEscapeRadius() float64 {
+	if m != nil {
+		return m.EscapeRadius
+	}
+	return 0
+}
+
+func (m *BlockRequest) GetWidth() int32 {
+	if m != nil {
+		return m.Width
+	}
+	return 0
+}
+
+func (m *BlockRequest) GetHeight() int32 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
 type BlockReply struct {
-	Results []int32 `protobuf:"varint,10,rep,packed,name=results" json:"results,omitempty"`
+	Results       []int32     `protobuf:"varint,10,rep,packed,name=results" json:"results,omitempty"`
+	Smooth        []float32   `protobuf:"fixed32,11,rep,packed,name=smooth" json:"smooth,omitempty"`
+	XBlock        int32       `protobuf:"varint,12,opt,name=xBlock" json:"xBlock,omitempty"`
+	YBlock        int32       `protobuf:"varint,13,opt,name=yBlock" json:"yBlock,omitempty"`
+	Packed        []byte      `protobuf:"bytes,14,opt,name=packed,proto3" json:"packed,omitempty"`
+	BitDepth      int32       `protobuf:"varint,15,opt,name=bitDepth" json:"bitDepth,omitempty"`
+	Compression   Compression `protobuf:"varint,16,opt,name=compression,enum=rpc.Compression" json:"compression,omitempty"`
+	KernelVersion int32       `protobuf:"varint,17,opt,name=kernelVersion" json:"kernelVersion,omitempty"`
 }
 
 func (m *BlockReply) Reset()                    { *m = BlockReply{} }
 func (m *BlockReply) String() string            { return proto.CompactTextString(m) }
 func (*BlockReply) ProtoMessage()               {}
-func (*BlockReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+func (*BlockReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
 
 func (m *BlockReply) GetResults() []int32 {
 	if m != nil {
@@ -166,6 +404,106 @@ func (m *BlockReply) GetResults() []int32 {
 	return nil
 }
 
+func (m *BlockReply) GetSmooth() []float32 {
+	if m != nil {
+		return m.Smooth
+	}
+	return nil
+}
+
+func (m *BlockReply) GetXBlock() int32 {
+	if m != nil {
+		return m.XBlock
+	}
+	return 0
+}
+
+func (m *BlockReply) GetYBlock() int32 {
+	if m != nil {
+		return m.YBlock
+	}
+	return 0
+}
+
+func (m *BlockReply) GetPacked() []byte {
+	if m != nil {
+		return m.Packed
+	}
+	return nil
+}
+
+func (m *BlockReply) GetBitDepth() int32 {
+	if m != nil {
+		return m.BitDepth
+	}
+	return 0
+}
+
+func (m *BlockReply) GetCompression() Compression {
+	if m != nil {
+		return m.Compression
+	}
+	return Compression_NONE
+}
+
+func (m *BlockReply) GetKernelVersion() int32 {
+	if m != nil {
+		return m.KernelVersion
+	}
+	return 0
+}
+
+type BlockIndex struct {
+	XBlock int32 `protobuf:"varint,1,opt,name=xBlock" json:"xBlock,omitempty"`
+	YBlock int32 `protobuf:"varint,2,opt,name=yBlock" json:"yBlock,omitempty"`
+}
+
+func (m *BlockIndex) Reset()                    { *m = BlockIndex{} }
+func (m *BlockIndex) String() string            { return proto.CompactTextString(m) }
+func (*BlockIndex) ProtoMessage()               {}
+func (*BlockIndex) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *BlockIndex) GetXBlock() int32 {
+	if m != nil {
+		return m.XBlock
+	}
+	return 0
+}
+
+func (m *BlockIndex) GetYBlock() int32 {
+	if m != nil {
+		return m.YBlock
+	}
+	return 0
+}
+
+// FrameRequest renders the blocks of a frame in a single call. The blocks
+// share the parameters of frame, whose xBlock and yBlock are ignored. When
+// blocks is empty every block of the frame is rendered.
+type FrameRequest struct {
+	Frame  *BlockRequest `protobuf:"bytes,1,opt,name=frame" json:"frame,omitempty"`
+	Blocks []*BlockIndex `protobuf:"bytes,2,rep,name=blocks" json:"blocks,omitempty"`
+}
+
+func (m *FrameRequest) Reset()                    { *m = FrameRequest{} }
+func (m *FrameRequest) String() string            { return proto.CompactTextString(m) }
+func (*FrameRequest) ProtoMessage()               {}
+func (*FrameRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *FrameRequest) GetFrame() *BlockRequest {
+	if m != nil {
+		return m.Frame
+	}
+	return nil
+}
+
+func (m *FrameRequest) GetBlocks() []*BlockIndex {
+	if m != nil {
+		return m.Blocks
+	}
+	return nil
+}
+
 type HealthCheckRequest struct {
 	Service string `protobuf:"bytes,1,opt,name=service" json:"service,omitempty"`
 }
@@ -173,7 +511,7 @@ type HealthCheckRequest struct {
 func (m *HealthCheckRequest) Reset()                    { *m = HealthCheckRequest{} }
 func (m *HealthCheckRequest) String() string            { return proto.CompactTextString(m) }
 func (*HealthCheckRequest) ProtoMessage()               {}
-func (*HealthCheckRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+func (*HealthCheckRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
 
 func (m *HealthCheckRequest) GetService() string {
 	if m != nil {
@@ -189,7 +527,7 @@ type HealthCheckResponse struct {
 func (m *HealthCheckResponse) Reset()                    { *m = HealthCheckResponse{} }
 func (m *HealthCheckResponse) String() string            { return proto.CompactTextString(m) }
 func (*HealthCheckResponse) ProtoMessage()               {}
-func (*HealthCheckResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+func (*HealthCheckResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
 
 func (m *HealthCheckResponse) GetStatus() HealthCheckResponse_ServingStatus {
 	if m != nil {
@@ -200,10 +538,17 @@ func (m *HealthCheckResponse) GetStatus() HealthCheckResponse_ServingStatus {
 
 func init() {
 	proto.RegisterType((*ComplexPoint)(nil), "rpc.ComplexPoint")
+	proto.RegisterType((*DeepViewport)(nil), "rpc.DeepViewport")
 	proto.RegisterType((*BlockRequest)(nil), "rpc.BlockRequest")
 	proto.RegisterType((*BlockReply)(nil), "rpc.BlockReply")
+	proto.RegisterType((*BlockIndex)(nil), "rpc.BlockIndex")
+	proto.RegisterType((*FrameRequest)(nil), "rpc.FrameRequest")
 	proto.RegisterType((*HealthCheckRequest)(nil), "rpc.HealthCheckRequest")
 	proto.RegisterType((*HealthCheckResponse)(nil), "rpc.HealthCheckResponse")
+	proto.RegisterEnum("rpc.FractalKind", FractalKind_name, FractalKind_value)
+	proto.RegisterEnum("rpc.Algorithm", Algorithm_name, Algorithm_value)
+	proto.RegisterEnum("rpc.Encoding", Encoding_name, Encoding_value)
+	proto.RegisterEnum("rpc.Compression", Compression_name, Compression_value)
 	proto.RegisterEnum("rpc.HealthCheckResponse_ServingStatus", HealthCheckResponse_ServingStatus_name, HealthCheckResponse_ServingStatus_value)
 }
 
@@ -219,6 +564,7 @@ const _ = grpc.SupportPackageIsVersion4
 
 type MandelServiceClient interface {
 	ComputeMandel(ctx context.Context, in *BlockRequest, opts ...grpc.CallOption) (*BlockReply, error)
+	ComputeFrame(ctx context.Context, in *FrameRequest, opts ...grpc.CallOption) (MandelService_ComputeFrameClient, error)
 }
 
 type mandelServiceClient struct {
@@ -238,10 +584,43 @@ func (c *mandelServiceClient) ComputeMandel(ctx context.Context, in *BlockReques
 	return out, nil
 }
 
+func (c *mandelServiceClient) ComputeFrame(ctx context.Context, in *FrameRequest, opts ...grpc.CallOption) (MandelService_ComputeFrameClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_MandelService_serviceDesc.Streams[0], c.cc, "/rpc.MandelService/ComputeFrame", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &mandelServiceComputeFrameClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MandelService_ComputeFrameClient interface {
+	Recv() (*BlockReply, error)
+	grpc.ClientStream
+}
+
+type mandelServiceComputeFrameClient struct {
+	grpc.ClientStream
+}
+
+func (x *mandelServiceComputeFrameClient) Recv() (*BlockReply, error) {
+	m := new(BlockReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for MandelService service
 
 type MandelServiceServer interface {
 	ComputeMandel(context.Context, *BlockRequest) (*BlockReply, error)
+	ComputeFrame(*FrameRequest, MandelService_ComputeFrameServer) error
 }
 
 func RegisterMandelServiceServer(s *grpc.Server, srv MandelServiceServer) {
@@ -266,6 +645,27 @@ func _MandelService_ComputeMandel_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MandelService_ComputeFrame_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FrameRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MandelServiceServer).ComputeFrame(m, &mandelServiceComputeFrameServer{stream})
+}
+
+type MandelService_ComputeFrameServer interface {
+	Send(*BlockReply) error
+	grpc.ServerStream
+}
+
+type mandelServiceComputeFrameServer struct {
+	grpc.ServerStream
+}
+
+func (x *mandelServiceComputeFrameServer) Send(m *BlockReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _MandelService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "rpc.MandelService",
 	HandlerType: (*MandelServiceServer)(nil),
@@ -275,7 +675,13 @@ var _MandelService_serviceDesc = grpc.ServiceDesc{
 			Handler:    _MandelService_ComputeMandel_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ComputeFrame",
+			Handler:       _MandelService_ComputeFrame_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "rpc.proto",
 }
 
@@ -346,30 +752,64 @@ var _Health_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("rpc.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 394 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x92, 0xcf, 0x8e, 0xd3, 0x30,
-	0x10, 0xc6, 0xd7, 0xdb, 0x4d, 0x42, 0xa7, 0x2d, 0xbb, 0x0c, 0x12, 0x58, 0x15, 0x87, 0x2a, 0x12,
-	0x55, 0xe1, 0x90, 0x43, 0x10, 0x97, 0x1e, 0x38, 0x50, 0x0a, 0x54, 0x88, 0x14, 0x39, 0xfc, 0x39,
-	0xa2, 0x34, 0xb5, 0x68, 0x45, 0x9a, 0x98, 0xd8, 0x41, 0x09, 0x6f, 0xc1, 0x2b, 0xf2, 0x24, 0xc8,
-	0x76, 0x4a, 0x5b, 0xd1, 0x3d, 0xfe, 0xbe, 0x99, 0xf9, 0xf4, 0x79, 0xc6, 0xd0, 0x2d, 0x45, 0x1a,
-	0x88, 0xb2, 0x50, 0x05, 0x76, 0x4a, 0x91, 0xfa, 0x4f, 0xa1, 0x3f, 0x2b, 0x76, 0x22, 0xe3, 0xf5,
-	0x87, 0x62, 0x9b, 0x2b, 0xec, 0x03, 0xa9, 0x29, 0x19, 0x91, 0x09, 0x61, 0xa4, 0xd6, 0xd4, 0xd0,
-	0x4b, 0x4b, 0x8d, 0xff, 0x87, 0x40, 0xff, 0x65, 0x56, 0xa4, 0xdf, 0x19, 0xff, 0x51, 0x71, 0xa9,
-	0xf0, 0x09, 0xb8, 0x22, 0x56, 0x49, 0xa9, 0xcc, 0x44, 0x2f, 0xbc, 0x17, 0x68, 0xf7, 0x63, 0x3f,
-	0xd6, 0x36, 0xe0, 0x63, 0xb8, 0x12, 0xf3, 0x7c, 0x6d, 0xcc, 0xce, 0x36, 0x9a, 0x32, 0x3e, 0x00,
-	0x57, 0x68, 0x94, 0xb4, 0x33, 0x22, 0x13, 0x87, 0xb5, 0x84, 0x43, 0xb8, 0xb3, 0x4b, 0xea, 0x85,
-	0xe2, 0xa5, 0xa4, 0x57, 0xa6, 0xf2, 0x8f, 0xf1, 0x11, 0x74, 0x57, 0x3a, 0x55, 0xbc, 0xfd, 0xc5,
-	0xa9, 0x63, 0x8a, 0x07, 0x41, 0x3b, 0xd6, 0x26, 0x34, 0x75, 0xad, 0xa3, 0x25, 0xad, 0x37, 0x56,
-	0xf7, 0xac, 0x6e, 0xc9, 0x1f, 0x03, 0xb4, 0x6f, 0x14, 0x59, 0x83, 0x14, 0xbc, 0x92, 0xcb, 0x2a,
-	0x53, 0x92, 0xc2, 0xa8, 0x33, 0x71, 0xd8, 0x1e, 0xfd, 0x00, 0xf0, 0x2d, 0x4f, 0x32, 0xb5, 0x99,
-	0x6d, 0xf8, 0x61, 0x23, 0x14, 0x3c, 0xc9, 0xcb, 0x9f, 0xdb, 0x94, 0x9b, 0x95, 0x74, 0xd9, 0x1e,
-	0xfd, 0xdf, 0x04, 0xee, 0x9f, 0x0c, 0x48, 0x51, 0xe4, 0x92, 0xe3, 0x0b, 0x70, 0xa5, 0x4a, 0x54,
-	0x25, 0xcd, 0xc0, 0xdd, 0x70, 0x6c, 0x56, 0x73, 0xa6, 0x33, 0x88, 0xb5, 0x53, 0xfe, 0x2d, 0x36,
-	0xdd, 0xac, 0x9d, 0xf2, 0xa7, 0x30, 0x38, 0x29, 0x60, 0x0f, 0xbc, 0x4f, 0xd1, 0xbb, 0x68, 0xf9,
-	0x25, 0xba, 0xb9, 0xd0, 0x10, 0xcf, 0xd9, 0xe7, 0x45, 0xf4, 0xe6, 0x86, 0xe0, 0x35, 0xf4, 0xa2,
-	0xe5, 0xc7, 0xaf, 0x7b, 0xe1, 0x32, 0x7c, 0x0d, 0x83, 0xf7, 0x49, 0xbe, 0xe6, 0x59, 0x6c, 0x43,
-	0xe2, 0x73, 0x18, 0xe8, 0xa3, 0x54, 0x8a, 0x5b, 0x1d, 0xed, 0xa1, 0x8e, 0x8f, 0x3e, 0xbc, 0x3e,
-	0x96, 0x44, 0xd6, 0xf8, 0x17, 0xe1, 0x2b, 0x70, 0x6d, 0x60, 0x9c, 0x82, 0x63, 0x42, 0xe3, 0xc3,
-	0xff, 0x9f, 0x61, 0xc7, 0xe9, 0x6d, 0xef, 0x5b, 0xb9, 0xe6, 0x5b, 0x3e, 0xfb, 0x1b, 0x00, 0x00,
-	0xff, 0xff, 0xc2, 0x66, 0xcd, 0x42, 0xa3, 0x02, 0x00, 0x00,
+	// 936 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x55, 0x5f, 0x6f, 0xe2, 0x46,
+	0x10, 0xcf, 0x9a, 0x40, 0x60, 0x30, 0x89, 0x33, 0x57, 0xb5, 0xab, 0xa8, 0x52, 0x91, 0x95, 0xf6,
+	0xb8, 0xa8, 0x42, 0x15, 0x6d, 0x4f, 0x55, 0x54, 0x55, 0x85, 0x60, 0xae, 0x5c, 0x72, 0x80, 0x16,
+	0x92, 0xf6, 0xfa, 0xd2, 0x3a, 0xf6, 0x5e, 0xb0, 0x30, 0xb6, 0x6b, 0x2f, 0x77, 0xd0, 0x87, 0x7e,
+	0x87, 0x7e, 0xd2, 0x7e, 0x81, 0x3e, 0x54, 0xbb, 0x36, 0x60, 0x9a, 0xe3, 0xe5, 0xde, 0xfc, 0xfb,
+	0xcd, 0x9f, 0xdd, 0x99, 0xf9, 0xcd, 0x1a, 0x2a, 0x71, 0xe4, 0x34, 0xa3, 0x38, 0x14, 0x21, 0x16,
+	0xe2, 0xc8, 0x31, 0x2f, 0x40, 0xbf, 0x0a, 0xe7, 0x91, 0xcf, 0x97, 0xa3, 0xd0, 0x0b, 0x04, 0xea,
+	0x40, 0x96, 0x94, 0xd4, 0x49, 0x83, 0x30, 0xb2, 0x94, 0x68, 0x45, 0xb5, 0x14, 0xad, 0xcc, 0x3b,
+	0xd0, 0xbb, 0x9c, 0x47, 0x77, 0x1e, 0x7f, 0x17, 0x85, 0xb1, 0x40, 0x0a, 0x47, 0x0e, 0x0f, 0x04,
+	0x8f, 0x7f, 0x51, 0x11, 0x15, 0xb6, 0x86, 0x5b, 0xcb, 0x6b, 0xaa, 0xe5, 0x2d, 0xaf, 0x11, 0xe1,
+	0x30, 0x89, 0xec, 0x80, 0x16, 0x14, 0xad, 0xbe, 0xcd, 0x7f, 0x8a, 0xa0, 0x77, 0xfc, 0xd0, 0x99,
+	0x31, 0xfe, 0xc7, 0x82, 0x27, 0x02, 0x9f, 0x41, 0x29, 0x1a, 0x0b, 0x3b, 0x16, 0x2a, 0x6f, 0xb5,
+	0x75, 0xda, 0x94, 0xb7, 0xce, 0xdf, 0x93, 0x65, 0x0e, 0xf8, 0x39, 0x1c, 0x46, 0x56, 0xe0, 0x52,
+	0x6d, 0x9f, 0xa3, 0x32, 0xe3, 0xc7, 0x50, 0x8a, 0x24, 0x4c, 0xd4, 0xc1, 0x45, 0x96, 0x21, 0x3c,
+	0x83, 0xf2, 0xdc, 0x5e, 0xf6, 0x05, 0x8f, 0x13, 0x7a, 0xa8, 0x2c, 0x1b, 0x8c, 0x9f, 0x42, 0xe5,
+	0x5e, 0xde, 0x6a, 0xec, 0xfd, 0xc9, 0x69, 0x51, 0x19, 0xb7, 0x84, 0xcc, 0xb8, 0x54, 0x97, 0xa6,
+	0xa5, 0x34, 0x63, 0x8a, 0x24, 0xbf, 0x4a, 0xf9, 0xa3, 0x94, 0x5f, 0x6d, 0xf8, 0x64, 0x1e, 0x86,
+	0x62, 0x4a, 0xcb, 0x75, 0xd2, 0x28, 0xb3, 0x0c, 0xe1, 0x39, 0x1c, 0xce, 0xbc, 0xc0, 0xa5, 0x95,
+	0x3a, 0x69, 0x1c, 0xb7, 0x0c, 0x55, 0x40, 0x2f, 0xb6, 0x1d, 0x61, 0xfb, 0xd7, 0x5e, 0xe0, 0x32,
+	0x65, 0xc5, 0xcf, 0x80, 0x38, 0x14, 0xf6, 0xd5, 0x48, 0x1c, 0xd9, 0xf1, 0x37, 0x61, 0x3c, 0x5f,
+	0xf8, 0x36, 0xad, 0xa6, 0x1d, 0xcf, 0x20, 0xbe, 0x84, 0x5a, 0xf6, 0x39, 0xb2, 0x63, 0x7b, 0x9e,
+	0x50, 0xbd, 0x5e, 0x68, 0x54, 0x5b, 0xe7, 0x2a, 0x4d, 0xbe, 0xed, 0xcd, 0x5e, 0xde, 0xcd, 0x0a,
+	0x44, 0xbc, 0x62, 0xbb, 0xa1, 0xb2, 0xdb, 0x2e, 0xe7, 0x11, 0xad, 0xe5, 0x6e, 0x92, 0x97, 0x04,
+	0x53, 0x66, 0xfc, 0x12, 0x2a, 0xb6, 0xff, 0x10, 0xc6, 0x9e, 0x98, 0xce, 0xe9, 0xb1, 0x2a, 0xec,
+	0x58, 0xf9, 0xb6, 0xd7, 0x2c, 0xdb, 0x3a, 0xe0, 0x33, 0x28, 0xf3, 0xc0, 0x09, 0x5d, 0x2f, 0x78,
+	0xa0, 0x27, 0xca, 0xb9, 0xa6, 0x9c, 0xad, 0x8c, 0x64, 0x1b, 0x33, 0xb6, 0xa0, 0xea, 0x84, 0xf3,
+	0x28, 0xe6, 0x49, 0xe2, 0x85, 0x01, 0x35, 0x72, 0x3d, 0xbb, 0xda, 0xf2, 0x2c, 0xef, 0x84, 0x26,
+	0xe8, 0x3c, 0x71, 0xec, 0x88, 0x33, 0xdb, 0xf5, 0x16, 0x09, 0x3d, 0x55, 0x72, 0xde, 0xe1, 0xf0,
+	0x23, 0x28, 0xbe, 0xf3, 0x5c, 0x31, 0xa5, 0xa8, 0x66, 0x96, 0x02, 0x39, 0xb2, 0x29, 0xf7, 0x1e,
+	0xa6, 0x82, 0x3e, 0x49, 0x47, 0x99, 0xa2, 0xb3, 0x1f, 0x01, 0x1f, 0xb7, 0x0a, 0x0d, 0x28, 0xcc,
+	0xf8, 0x2a, 0xdb, 0x04, 0xf9, 0x29, 0xb3, 0xbe, 0xb5, 0xfd, 0x05, 0xcf, 0x36, 0x28, 0x05, 0x97,
+	0xda, 0x77, 0xc4, 0xfc, 0x97, 0x00, 0x64, 0xad, 0x8f, 0xfc, 0x95, 0x1c, 0x5e, 0xcc, 0x93, 0x85,
+	0x2f, 0x12, 0x0a, 0xf5, 0x42, 0xa3, 0xc8, 0xd6, 0x30, 0xa7, 0x9a, 0x6a, 0xbd, 0xd0, 0xd0, 0x36,
+	0xaa, 0xd9, 0xaa, 0x4f, 0xdf, 0xa3, 0xbe, 0xda, 0xff, 0xd5, 0x17, 0xd9, 0xce, 0x8c, 0xbb, 0x6a,
+	0x1c, 0x3a, 0xcb, 0x90, 0xd4, 0xff, 0xbd, 0x27, 0xba, 0x3c, 0x12, 0x53, 0xd5, 0xfb, 0x22, 0xdb,
+	0xe0, 0x0f, 0x6a, 0xf6, 0x39, 0xd4, 0x66, 0x3c, 0x0e, 0xb8, 0x7f, 0xc7, 0x63, 0x15, 0x75, 0xaa,
+	0x92, 0xee, 0x92, 0xe6, 0xf7, 0x59, 0xf5, 0xfd, 0xc0, 0xe5, 0xcb, 0x5c, 0x2d, 0x64, 0x4f, 0x2d,
+	0x5a, 0xbe, 0x16, 0xf3, 0x77, 0xd0, 0x7b, 0xb1, 0x3d, 0xe7, 0xeb, 0xd7, 0xe2, 0x29, 0x14, 0xdf,
+	0x48, 0xbc, 0xf3, 0x58, 0xe4, 0x85, 0xcd, 0x52, 0x3b, 0x3e, 0x85, 0x92, 0xda, 0xdf, 0x84, 0x6a,
+	0x6a, 0x05, 0x4e, 0xb6, 0x9e, 0xea, 0x26, 0x2c, 0x33, 0x9b, 0x4d, 0xc0, 0x9f, 0xb8, 0xed, 0x8b,
+	0xe9, 0xd5, 0x94, 0x6f, 0x5f, 0x25, 0x0a, 0x47, 0x09, 0x8f, 0xdf, 0x7a, 0x0e, 0x5f, 0x3f, 0x77,
+	0x19, 0x34, 0xff, 0x26, 0xf0, 0x64, 0x27, 0x20, 0x89, 0xc2, 0x20, 0xe1, 0xf8, 0x03, 0x94, 0x12,
+	0x61, 0x8b, 0x45, 0xa2, 0x02, 0x8e, 0x5b, 0x5f, 0xa8, 0x03, 0xdf, 0xe3, 0xd9, 0x1c, 0xcb, 0x4c,
+	0xc1, 0xc3, 0x58, 0x79, 0xb3, 0x2c, 0xca, 0xbc, 0x84, 0xda, 0x8e, 0x01, 0xab, 0x70, 0x74, 0x3b,
+	0xb8, 0x1e, 0x0c, 0x7f, 0x1e, 0x18, 0x07, 0x12, 0x8c, 0x2d, 0x76, 0xd7, 0x1f, 0xbc, 0x30, 0x08,
+	0x9e, 0x40, 0x75, 0x30, 0x9c, 0xfc, 0xb6, 0x26, 0xb4, 0x8b, 0x06, 0x54, 0x73, 0xcf, 0x08, 0x1e,
+	0x03, 0xbc, 0x6a, 0x0f, 0xba, 0xd6, 0x4d, 0x87, 0x0d, 0x27, 0xc6, 0x01, 0x56, 0xa0, 0xf8, 0xf2,
+	0xf6, 0xa6, 0xdf, 0x36, 0xc8, 0x45, 0x07, 0x2a, 0x9b, 0xbd, 0xc4, 0x32, 0x1c, 0xb6, 0x6f, 0x27,
+	0xc3, 0x34, 0x7d, 0xef, 0x66, 0xd8, 0x9e, 0x3c, 0xff, 0xc6, 0x20, 0xa8, 0x43, 0xb9, 0xd3, 0x7f,
+	0xa1, 0xb0, 0xa1, 0xa1, 0x01, 0xfa, 0xc8, 0x62, 0x93, 0x5b, 0xd6, 0x69, 0x4f, 0xfa, 0xc3, 0x81,
+	0x51, 0xb8, 0x38, 0x87, 0xf2, 0x7a, 0x5d, 0xa5, 0x2f, 0xb3, 0x46, 0x56, 0x7b, 0x62, 0x75, 0x8d,
+	0x03, 0x04, 0x28, 0x8d, 0xda, 0x57, 0xd7, 0x56, 0xd7, 0x20, 0x17, 0x4d, 0xa8, 0xe6, 0x94, 0x23,
+	0xcf, 0x1a, 0x0c, 0x07, 0x56, 0x7a, 0x56, 0xd7, 0xea, 0xdd, 0xb4, 0x27, 0x96, 0x41, 0x24, 0xfd,
+	0xeb, 0x78, 0xd2, 0x35, 0xb4, 0xd6, 0x5f, 0x50, 0x7b, 0x65, 0x07, 0x2e, 0xf7, 0xc7, 0x69, 0xa3,
+	0xf1, 0x5b, 0xa8, 0xc9, 0x04, 0x0b, 0xc1, 0x53, 0x1e, 0x1f, 0x0f, 0xfb, 0xec, 0x24, 0x4f, 0x45,
+	0xfe, 0xca, 0x3c, 0xc0, 0xe7, 0xe9, 0x4f, 0x6e, 0x21, 0xb8, 0x12, 0x4e, 0x16, 0x95, 0x17, 0xd1,
+	0x7b, 0xa2, 0xbe, 0x22, 0xad, 0x2e, 0x94, 0xd2, 0x61, 0xe1, 0x25, 0x14, 0xd5, 0xc0, 0xf0, 0x93,
+	0xc7, 0x23, 0x4c, 0x13, 0xd0, 0x7d, 0xb3, 0xbd, 0x2f, 0xa9, 0xdf, 0xed, 0xd7, 0xff, 0x0d, 0x00,
+	0x8a, 0x78, 0xc8, 0xd3, 0x7b, 0x07, 0x00, 0x00,
 }